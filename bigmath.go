@@ -0,0 +1,396 @@
+package main
+
+import (
+	"math"
+	"math/big"
+)
+
+// Elementary functions at arbitrary precision. Results which float64 math
+// can't round correctly are computed with these, using Ziv's strategy of
+// raising the precision until the rounding is certain.
+
+// maxZivPrec bounds the precision zivRound tries before settling for the
+// nearest value.
+const maxZivPrec = 1 << 14
+
+// maxPowExp bounds the binary exponents of results. Every format overflows
+// or underflows well before it.
+const maxPowExp = 1 << 30
+
+// roundOdd sets z to x rounded to z's precision by truncating it and setting
+// the last bit if any bits were lost. Rounding to odd with at least two bits
+// more than a format and then to nearest gives the correctly rounded result.
+func roundOdd(z, x *big.Float) *big.Float {
+	acc := z.SetMode(big.ToZero).Set(x).Acc()
+	z.SetMode(big.ToNearestEven)
+	if acc == big.Exact || z.IsInf() {
+		return z
+	}
+	mant := new(big.Float)
+	exp := z.MantExp(mant)
+	prec := int(z.Prec())
+	i, _ := mant.SetMantExp(mant, prec).Int(nil)
+	neg := i.Sign() < 0
+	i.Abs(i).SetBit(i, 0, 1)
+	if neg {
+		i.Neg(i)
+	}
+	z.SetInt(i)
+	return z.SetMantExp(z, exp-prec)
+}
+
+// zivRound sets z to a value rounded to odd at z's precision. approx(w) must
+// return the value with a relative error below 2**-w, and the value must not
+// be exactly representable with a few more bits than z's precision.
+func zivRound(z *big.Float, approx func(w uint) *big.Float) *big.Float {
+	for w := z.Prec() + 32; ; w *= 2 {
+		v := approx(w)
+		if v.Sign() == 0 || v.IsInf() || w >= maxZivPrec {
+			return roundOdd(z, v)
+		}
+		// The value is within eps of v, and rounds the same as both ends of
+		// that interval if they round the same.
+		eps := new(big.Float).SetMantExp(big.NewFloat(0.5), v.MantExp(nil)-int(w)+1)
+		prec := max(v.Prec(), w) + 2
+		lo := roundOdd(new(big.Float).SetPrec(z.Prec()), new(big.Float).SetPrec(prec).Sub(v, eps))
+		hi := roundOdd(new(big.Float).SetPrec(z.Prec()), new(big.Float).SetPrec(prec).Add(v, eps))
+		if lo.Cmp(hi) == 0 {
+			return z.Set(lo)
+		}
+	}
+}
+
+var ln2Cache = new(big.Float)
+
+// bigLn2 returns ln(2) with a relative error below 2**-prec.
+func bigLn2(prec uint) *big.Float {
+	if ln2Cache.Prec() < prec+32 {
+		// ln(2) = 2 atanh(1/3)
+		w := prec + 64
+		third := new(big.Float).SetPrec(w).Quo(big.NewFloat(1), big.NewFloat(3))
+		ln2Cache = atanhSeries(third, w)
+		ln2Cache.Mul(ln2Cache, big.NewFloat(2))
+	}
+	return ln2Cache
+}
+
+// atanhSeries returns atanh(t) for small t from its Taylor series, computed
+// with prec bits.
+func atanhSeries(t *big.Float, prec uint) *big.Float { return oddSeries(t, false, prec) }
+
+// atanSeries returns atan(t) for small t from its Taylor series, computed with
+// prec bits.
+func atanSeries(t *big.Float, prec uint) *big.Float { return oddSeries(t, true, prec) }
+
+// oddSeries returns the sum of t**(2i+1) / (2i+1) for i >= 0, with the signs
+// of the terms alternating if alt, computed with prec bits.
+func oddSeries(t *big.Float, alt bool, prec uint) *big.Float {
+	t2 := new(big.Float).SetPrec(prec).Mul(t, t)
+	if alt {
+		t2.Neg(t2)
+	}
+	sum := new(big.Float).SetPrec(prec).Set(t)
+	term := new(big.Float).SetPrec(prec).Set(t)
+	d := new(big.Float).SetPrec(prec)
+	div := new(big.Float)
+	for i := int64(3); ; i += 2 {
+		term.Mul(term, t2)
+		d.Quo(term, div.SetInt64(i))
+		if d.Sign() == 0 || d.MantExp(nil) < sum.MantExp(nil)-int(prec) {
+			return sum
+		}
+		sum.Add(sum, d)
+	}
+}
+
+var piCache = new(big.Float)
+
+// bigPi returns pi with a relative error below 2**-prec.
+func bigPi(prec uint) *big.Float {
+	if piCache.Prec() < prec+32 {
+		// Machin's formula, pi = 16 atan(1/5) - 4 atan(1/239)
+		w := prec + 64
+		a := atanSeries(new(big.Float).SetPrec(w).Quo(big.NewFloat(1), big.NewFloat(5)), w)
+		b := atanSeries(new(big.Float).SetPrec(w).Quo(big.NewFloat(1), big.NewFloat(239)), w)
+		a.Mul(a, big.NewFloat(16))
+		piCache = a.Sub(a, b.Mul(b, big.NewFloat(4)))
+	}
+	return piCache
+}
+
+// bigHalfPi returns pi/2 with prec bits and a relative error below 2**-prec.
+func bigHalfPi(prec uint) *big.Float {
+	x := new(big.Float).SetPrec(prec).Set(bigPi(prec))
+	return x.SetMantExp(x, -1)
+}
+
+// bigLog returns ln(x), for finite x > 0, with a relative error below
+// 2**-prec.
+func bigLog(x *big.Float, prec uint) *big.Float {
+	w := prec + 32
+	// x = m * 2**e with sqrt(1/2) <= m < sqrt(2), so that
+	// ln(x) = e ln(2) + 2 atanh((m-1)/(m+1)) and the series converges quickly.
+	m := new(big.Float).SetPrec(max(w, x.Prec()))
+	e := x.MantExp(m)
+	if new(big.Float).Mul(m, m).Cmp(big.NewFloat(0.5)) < 0 {
+		m.SetMantExp(m, 1)
+		e--
+	}
+	num := new(big.Float).SetPrec(w).Sub(m, big.NewFloat(1))
+	den := new(big.Float).SetPrec(w).Add(m, big.NewFloat(1))
+	sum := atanhSeries(num.Quo(num, den), w)
+	sum.Mul(sum, big.NewFloat(2))
+	if e != 0 {
+		ln2 := bigLn2(w + 64)
+		sum.Add(sum, new(big.Float).SetPrec(w+64).Mul(ln2, big.NewFloat(float64(e))))
+	}
+	return sum
+}
+
+// bigExp returns e**t, for |t| < maxPowExp * ln(2), with a relative error
+// below 2**-prec.
+func bigExp(t *big.Float, prec uint) *big.Float {
+	// e**t = 2**k * (e**(r/2**squarings))**(2**squarings), with
+	// t = k ln(2) + r and |r| <= ln(2)/2.
+	const squarings = 8
+	w := prec + 32 + squarings
+	tf, _ := t.Float64()
+	k := int64(math.Round(tf / math.Ln2))
+	ln2 := bigLn2(w + 64)
+	r := new(big.Float).SetPrec(w+64).Mul(ln2, big.NewFloat(float64(k)))
+	r.Sub(t, r)
+	r.SetPrec(w).SetMantExp(r, -squarings)
+
+	sum := new(big.Float).SetPrec(w).SetInt64(1)
+	term := new(big.Float).SetPrec(w).SetInt64(1)
+	div := new(big.Float)
+	for i := int64(1); ; i++ {
+		term.Mul(term, r)
+		term.Quo(term, div.SetInt64(i))
+		if term.Sign() == 0 || term.MantExp(nil) < -int(w) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+	for i := 0; i < squarings; i++ {
+		sum.Mul(sum, sum)
+	}
+	return sum.SetMantExp(sum, int(k))
+}
+
+// powFloat sets z to x**y rounded to odd at z's precision, so that rounding it
+// again to a format with at least two fewer bits is correctly rounded. Special
+// cases follow math.Pow.
+func powFloat(z, x, y *big.Float) *big.Float {
+	if y.Sign() == 0 || x.Cmp(big.NewFloat(1)) == 0 {
+		return z.SetInt64(1)
+	}
+	if x.IsInf() || y.IsInf() || x.Sign() == 0 {
+		return z.SetFloat64(specialPow(x, y))
+	}
+	neg := false
+	if x.Sign() < 0 {
+		if !y.IsInt() {
+			panic(big.ErrNaN{})
+		}
+		i, _ := y.Int(nil)
+		neg = i.Bit(0) == 1
+		x = new(big.Float).Neg(x)
+	}
+
+	if r := exactPow(x, y); r != nil {
+		roundOdd(z, r)
+	} else {
+		// Estimate y ln(x) to check the range and size the precision of
+		// the logarithm, which loses bits to the magnitude of the product.
+		t := bigLog(x, 64)
+		tf, _ := t.Mul(t, y).Float64()
+		switch {
+		case tf > maxPowExp*math.Ln2:
+			z.SetMantExp(big.NewFloat(1), maxPowExp)
+		case tf < -maxPowExp*math.Ln2:
+			z.SetMantExp(big.NewFloat(1), -maxPowExp)
+		default:
+			_, mag := math.Frexp(tf)
+			extra := uint(max(mag, 0)) + 8
+			zivRound(z, func(w uint) *big.Float {
+				t := bigLog(x, w+extra)
+				t.Mul(t, y)
+				return bigExp(t, w+4)
+			})
+		}
+	}
+	if neg {
+		z.Neg(z)
+	}
+	return z
+}
+
+// specialPow returns x**y when x is zero or infinite or y is infinite, using
+// float64 stand-ins for the operands which keep the properties that math.Pow
+// looks at.
+func specialPow(x, y *big.Float) float64 {
+	xf, _ := x.Float64()
+	if !x.IsInf() && x.Sign() != 0 {
+		// y is infinite, so only the sign of x and how it compares with 1
+		// matter.
+		xf = math.Copysign([]float64{0.5, 1, 2}[new(big.Float).Abs(x).Cmp(big.NewFloat(1))+1], xf)
+	}
+	yf, _ := y.Float64()
+	if !y.IsInf() {
+		// x is zero or infinite, so only the sign of y and whether it is an
+		// odd integer matter.
+		yf = math.Copysign(2, yf)
+		if i, acc := y.Int(nil); acc == big.Exact && i.Bit(0) == 1 {
+			yf = math.Copysign(1, yf)
+		}
+	}
+	return math.Pow(xf, yf)
+}
+
+// exactPow returns x**y for x > 0 if the result is a binary fraction small
+// enough to compute exactly, or nil otherwise.
+func exactPow(x, y *big.Float) *big.Float {
+	m, e := oddMant(x)
+	ym, ye := oddMant(y)
+	if ye > 64 {
+		// y is so large that x**y overflows or underflows unless x is 1.
+		ym, ye = big.NewInt(int64(ym.Sign())), 64
+	}
+	// x**(ym / 2**-ye) for ye < 0 is a binary fraction only if x is a
+	// perfect 2**-ye th power.
+	for ; ye < 0; ye++ {
+		r := new(big.Int).Sqrt(m)
+		if e%2 != 0 || new(big.Int).Mul(r, r).Cmp(m) != 0 {
+			return nil
+		}
+		m, e = r, e/2
+	}
+	k := new(big.Int).Lsh(ym, uint(ye))
+
+	if m.Cmp(big1) == 0 {
+		exp := new(big.Int).Mul(k, big.NewInt(int64(e)))
+		exp = bigClamp(exp, maxPowExp)
+		return new(big.Float).SetMantExp(big.NewFloat(1), int(exp.Int64()))
+	}
+	if k.Sign() < 0 || !k.IsInt64() || k.Int64() > maxUntypedBits/int64(m.BitLen()) {
+		return nil
+	}
+	p := new(big.Int).Exp(m, k, nil)
+	exp := new(big.Int).Mul(k, big.NewInt(int64(e)))
+	exp = bigClamp(exp, maxPowExp)
+	r := new(big.Float).SetInt(p)
+	return r.SetMantExp(r, int(exp.Int64()))
+}
+
+// oddMant returns the odd integer m and exponent e with x = m * 2**e, for
+// finite non-zero x.
+func oddMant(x *big.Float) (*big.Int, int) {
+	mant := new(big.Float)
+	e := x.MantExp(mant)
+	prec := int(mant.MinPrec())
+	m, _ := mant.SetMantExp(mant, prec).Int(nil)
+	return m, e - prec
+}
+
+// bigClamp limits v to [-limit, limit].
+func bigClamp(v *big.Int, limit int64) *big.Int {
+	if v.Cmp(big.NewInt(limit)) > 0 {
+		return big.NewInt(limit)
+	}
+	if v.Cmp(big.NewInt(-limit)) < 0 {
+		return big.NewInt(-limit)
+	}
+	return v
+}
+
+// bigSinCos returns sin(x) and cos(x), for finite x, each with a relative
+// error below 2**-prec.
+func bigSinCos(x *big.Float, prec uint) (sin, cos *big.Float) {
+	// x = k pi/2 + r with |r| <= pi/4. The reduction loses the bits of x
+	// above the binary point, and more when x is close to a multiple of
+	// pi/2, in which case it is repeated with the precision that r needs.
+	w := prec + 32
+	extra := uint(max(x.MantExp(nil), 0)) + 32
+	k := new(big.Int)
+	r := new(big.Float)
+	for {
+		halfPi := bigHalfPi(w + extra)
+		// k is x/(pi/2) rounded to nearest, with ties away from zero.
+		q := new(big.Float).SetPrec(extra+32).Quo(x, halfPi)
+		q.Add(q, big.NewFloat(math.Copysign(0.5, float64(q.Sign()))))
+		q.Int(k)
+		r.SetPrec(w + extra).SetInt(k)
+		r.Sub(x, r.Mul(r, halfPi))
+		if k.Sign() == 0 || r.Sign() != 0 && r.MantExp(nil) >= -32 {
+			break
+		}
+		if r.Sign() == 0 {
+			extra *= 2
+		} else {
+			extra += uint(-r.MantExp(nil))
+		}
+	}
+	r.SetPrec(w)
+	s, c := sinCosSeries(r, w)
+	switch new(big.Int).And(k, big.NewInt(3)).Int64() {
+	case 1:
+		s, c = c, s.Neg(s)
+	case 2:
+		s, c = s.Neg(s), c.Neg(c)
+	case 3:
+		s, c = c.Neg(c), s
+	}
+	return s, c
+}
+
+// sinCosSeries returns sin(r) and cos(r), for |r| <= pi/4, from their Taylor
+// series computed with prec bits.
+func sinCosSeries(r *big.Float, prec uint) (sin, cos *big.Float) {
+	r2 := new(big.Float).SetPrec(prec).Mul(r, r)
+	r2.Neg(r2)
+	series := func(term *big.Float, i int64) *big.Float {
+		sum := new(big.Float).SetPrec(prec).Set(term)
+		div := new(big.Float)
+		for ; ; i += 2 {
+			term.Mul(term, r2)
+			term.Quo(term, div.SetInt64(i*(i+1)))
+			if term.Sign() == 0 || term.MantExp(nil) < sum.MantExp(nil)-int(prec) {
+				return sum
+			}
+			sum.Add(sum, term)
+		}
+	}
+	sin = series(new(big.Float).SetPrec(prec).Set(r), 2)
+	cos = series(new(big.Float).SetPrec(prec).SetInt64(1), 1)
+	return sin, cos
+}
+
+// bigAtan returns atan(x), for finite x, with a relative error below
+// 2**-prec.
+func bigAtan(x *big.Float, prec uint) *big.Float {
+	w := prec + 32
+	t := new(big.Float).SetPrec(w).Abs(x)
+	invert := t.Cmp(big.NewFloat(1)) > 0
+	if invert {
+		t.Quo(big.NewFloat(1), t)
+	}
+	// atan(t) = 2 atan(t / (1 + sqrt(1 + t**2))) until t is small enough
+	// for the series to converge quickly.
+	halvings := 0
+	for ; t.Sign() != 0 && t.MantExp(nil) > -8; halvings++ {
+		d := new(big.Float).SetPrec(w).Mul(t, t)
+		d.Add(d, big.NewFloat(1)).Sqrt(d).Add(d, big.NewFloat(1))
+		t.Quo(t, d)
+	}
+	sum := atanSeries(t, w)
+	sum.SetMantExp(sum, halvings)
+	if invert {
+		// atan(x) = pi/2 - atan(1/x), which is at least pi/4.
+		sum.Sub(bigHalfPi(w), sum)
+	}
+	if x.Signbit() {
+		sum.Neg(sum)
+	}
+	return sum
+}
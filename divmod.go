@@ -0,0 +1,258 @@
+package main
+
+import (
+	"math"
+	"math/big"
+)
+
+// Division with the quotient rounded to an integer in one of several ways,
+// and the remainders which go with each.
+
+// quoMode selects how a quotient is rounded to an integer.
+type quoMode int
+
+const (
+	quoTrunc  quoMode = iota // Toward zero, as Go's / and % and C's fmod
+	quoFloor                 // Toward negative infinity, as Python's // and %
+	quoCeil                  // Toward positive infinity
+	quoEuclid                // So that the remainder is never negative
+	quoEven                  // To nearest with ties to even, as IEEE remainder
+	quoAway                  // To nearest with ties away from zero, as C's round
+)
+
+// roundQuo returns x/y rounded to an integer by mode, for y != 0.
+func roundQuo(x, y *big.Rat, mode quoMode) *big.Int {
+	if mode == quoEuclid {
+		mode = quoFloor
+		if y.Sign() < 0 {
+			mode = quoCeil
+		}
+	}
+	t := new(big.Rat).Quo(x, y)
+	// The denominator is positive, so this is floor division.
+	q, r := new(big.Int).DivMod(t.Num(), t.Denom(), new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+	switch mode {
+	case quoTrunc:
+		if t.Sign() < 0 {
+			q.Add(q, big1)
+		}
+	case quoCeil:
+		q.Add(q, big1)
+	case quoEven:
+		if c := r.Lsh(r, 1).Cmp(t.Denom()); c > 0 || c == 0 && q.Bit(0) == 1 {
+			q.Add(q, big1)
+		}
+	case quoAway:
+		if c := r.Lsh(r, 1).Cmp(t.Denom()); c > 0 || c == 0 && t.Sign() > 0 {
+			q.Add(q, big1)
+		}
+	}
+	return q
+}
+
+// quoRemRat returns x/y rounded to an integer by mode and the remainder
+// x - q*y, for y != 0.
+func quoRemRat(x, y *big.Rat, mode quoMode) (*big.Int, *big.Rat) {
+	q := roundQuo(x, y, mode)
+	r := new(big.Rat).SetInt(q)
+	return q, r.Sub(x, r.Mul(r, y))
+}
+
+// quoRemBig is quoRemRat for integers.
+func quoRemBig(x, y *big.Int, mode quoMode) (*big.Int, *big.Int) {
+	if y.Sign() == 0 {
+		panic(errDivideByZero)
+	}
+	q, r := quoRemRat(new(big.Rat).SetInt(x), new(big.Rat).SetInt(y), mode)
+	return q, r.Num()
+}
+
+// quoFloat sets z to x/y rounded to an integer by mode, rounded to odd at z's
+// precision. Zero quotients have the sign of x/y.
+func quoFloat(z, x, y *big.Float, mode quoMode) *big.Float {
+	neg := x.Signbit() != y.Signbit()
+	switch {
+	case x.IsInf() && y.IsInf(), x.Sign() == 0 && y.Sign() == 0:
+		panic(big.ErrNaN{})
+	case x.IsInf(), y.Sign() == 0:
+		return z.SetInf(neg)
+	case y.IsInf():
+		// The quotient is zero, approached from the side of its sign.
+		if x.Sign() != 0 {
+			if neg && roundsAway(mode, y, quoFloor) {
+				return z.SetInt64(-1)
+			}
+			if !neg && roundsAway(mode, y, quoCeil) {
+				return z.SetInt64(1)
+			}
+		}
+		return signedZero(z, neg)
+	}
+	xr, _ := x.Rat(nil)
+	yr, _ := y.Rat(nil)
+	q := roundQuo(xr, yr, mode)
+	if q.Sign() == 0 {
+		return signedZero(z, neg)
+	}
+	return roundOdd(z, new(big.Float).SetInt(q))
+}
+
+// remFloat sets z to x - q*y, where q is x/y rounded to an integer by mode,
+// rounded to odd at z's precision. Like fmod, the remainder is exact for
+// finite operands and NaN if x is infinite or y is zero.
+func remFloat(z, x, y *big.Float, mode quoMode) *big.Float {
+	switch {
+	case x.IsInf() || y.Sign() == 0:
+		panic(big.ErrNaN{})
+	case y.IsInf():
+		neg := x.Signbit() != y.Signbit()
+		if x.Sign() != 0 && (neg && roundsAway(mode, y, quoFloor) || !neg && roundsAway(mode, y, quoCeil)) {
+			// The quotient rounds to -1 or 1, leaving x + y or x - y.
+			return z.SetInf(neg == y.Signbit())
+		}
+		return z.Set(x)
+	}
+	xr, _ := x.Rat(nil)
+	yr, _ := y.Rat(nil)
+	_, r := quoRemRat(xr, yr, mode)
+	if r.Sign() != 0 {
+		return roundOdd(z, new(big.Float).SetPrec(0).SetRat(r))
+	}
+	// Zero remainders have the sign of x when the quotient is rounded toward
+	// zero or to nearest, and otherwise the sign that the rounding gives
+	// non-zero remainders.
+	switch mode {
+	case quoFloor:
+		return signedZero(z, y.Signbit())
+	case quoCeil:
+		return signedZero(z, !y.Signbit())
+	case quoEuclid:
+		return z.SetInt64(0)
+	}
+	return signedZero(z, x.Signbit())
+}
+
+// signedZero sets z to zero with the given sign.
+func signedZero(z *big.Float, neg bool) *big.Float {
+	z.SetInt64(0)
+	if neg {
+		z.Neg(z)
+	}
+	return z
+}
+
+// roundsAway reports whether mode rounds like dir, which is quoFloor or
+// quoCeil, for a divisor y.
+func roundsAway(mode quoMode, y *big.Float, dir quoMode) bool {
+	if mode == quoEuclid {
+		mode = quoFloor
+		if y.Signbit() {
+			mode = quoCeil
+		}
+	}
+	return mode == dir
+}
+
+// floatOp returns fn applied to float64 operands, with a NaN result for NaN
+// operands and invalid operations.
+func floatOp(fn FloatBinary) F64Binary {
+	return func(x, y float64) (out float64) {
+		if math.IsNaN(x) || math.IsNaN(y) {
+			return math.NaN()
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				if _, ok := r.(big.ErrNaN); !ok {
+					panic(r)
+				}
+				out = math.NaN()
+			}
+		}()
+		// Rounding to odd with 55 bits and then to 53 is correctly rounded.
+		z := fn(new(big.Float).SetPrec(55), big.NewFloat(x), big.NewFloat(y))
+		f, _ := z.Float64()
+		return f
+	}
+}
+
+// intOp returns fn applied to 64 bit integers, wrapping around on overflow.
+func intOp(fn BigBinary) I64Binary {
+	return func(x, y int64) int64 {
+		return int64(Uint128FromBig(fn(big.NewInt(x), big.NewInt(y))).Lo)
+	}
+}
+
+// uintOp is intOp for unsigned integers.
+func uintOp(fn BigBinary) U64Binary {
+	return func(x, y uint64) uint64 {
+		return Uint128FromBig(fn(new(big.Int).SetUint64(x), new(big.Int).SetUint64(y))).Lo
+	}
+}
+
+// quoOp returns the division operator which rounds by mode.
+func quoOp(n, m Num, mode quoMode) Num {
+	fnBig := func(x, y *big.Int) *big.Int {
+		q, _ := quoRemBig(x, y, mode)
+		return q
+	}
+	fnFloat := func(z, x, y *big.Float) *big.Float {
+		return quoFloat(z, x, y, mode)
+	}
+	fnRat := func(z, x, y *big.Rat) *big.Rat {
+		if y.Sign() == 0 {
+			return nil
+		}
+		return z.SetInt(roundQuo(x, y, mode))
+	}
+	return dispatchBinary(n, m, floatOp(fnFloat), intOp(fnBig), uintOp(fnBig), fnBig, fnFloat, fnRat)
+}
+
+// remOp returns the remainder operator which goes with quoOp.
+func remOp(n, m Num, mode quoMode) Num {
+	fnBig := func(x, y *big.Int) *big.Int {
+		_, r := quoRemBig(x, y, mode)
+		return r
+	}
+	fnFloat := func(z, x, y *big.Float) *big.Float {
+		return remFloat(z, x, y, mode)
+	}
+	fnRat := func(z, x, y *big.Rat) *big.Rat {
+		if y.Sign() == 0 {
+			return nil
+		}
+		_, r := quoRemRat(x, y, mode)
+		return z.Set(r)
+	}
+	return dispatchBinary(n, m, floatOp(fnFloat), intOp(fnBig), uintOp(fnBig), fnBig, fnFloat, fnRat)
+}
+
+// OpRem returns the remainder of truncated division, which has the sign of n.
+// For floats it is fmod.
+func (n Num) OpRem(m Num) Num { return remOp(n, m, quoTrunc) }
+
+// OpMod returns the remainder of floored division, which has the sign of m.
+func (n Num) OpMod(m Num) Num { return remOp(n, m, quoFloor) }
+
+// OpEmod returns the remainder of Euclidean division, which is never
+// negative.
+func (n Num) OpEmod(m Num) Num { return remOp(n, m, quoEuclid) }
+
+// OpRemainder returns the remainder of division rounded to nearest, which is
+// IEEE remainder for floats.
+func (n Num) OpRemainder(m Num) Num { return remOp(n, m, quoEven) }
+
+// OpTdiv divides, rounding the quotient toward zero.
+func (n Num) OpTdiv(m Num) Num { return quoOp(n, m, quoTrunc) }
+
+// OpFdiv divides, rounding the quotient down.
+func (n Num) OpFdiv(m Num) Num { return quoOp(n, m, quoFloor) }
+
+// OpCdiv divides, rounding the quotient up.
+func (n Num) OpCdiv(m Num) Num { return quoOp(n, m, quoCeil) }
+
+// OpEdiv divides, rounding the quotient so that the remainder is never
+// negative.
+func (n Num) OpEdiv(m Num) Num { return quoOp(n, m, quoEuclid) }
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// exactMode keeps untyped float literals as exact rationals until they are
+// converted to a float or fixed point format. It is set by the exact and
+// inexact commands.
+var exactMode bool
+
+var errRatTooLarge = errors.New("untyped rational too large")
+
+// FloatLit is a float literal, holding both its float64 value and its exact
+// value. R is nil if the exact value is too large to hold, and Err is set if
+// the float64 value is out of range.
+type FloatLit struct {
+	F   float64
+	R   *big.Rat
+	Err error
+}
+
+// Value returns the literal's exact value in exact mode and its float64 value
+// otherwise.
+func (l FloatLit) Value(exact bool) (any, error) {
+	if !exact {
+		return l.F, l.Err
+	}
+	if l.R == nil {
+		return nil, errRatTooLarge
+	}
+	return l.R, nil
+}
+
+// binaryLit returns the hex or binary literal s, with the value val, as a
+// FloatLit if it is a float.
+func binaryLit(s string, val any) any {
+	f, ok := val.(float64)
+	if !ok {
+		return val
+	}
+	// The mantissa is at most 64 bits, so parsing is exact.
+	x, _, err := big.ParseFloat(s, 0, 64, big.ToNearestEven)
+	if err != nil {
+		return FloatLit{f, nil, nil}
+	}
+	r, _ := x.Rat(nil)
+	return FloatLit{f, r, nil}
+}
+
+// parseRat parses a decimal literal exactly, returning nil if it is too large.
+func parseRat(s string) *big.Rat {
+	// Decimal exponents beyond this would need more than maxUntypedBits bits.
+	const maxExp = maxUntypedBits * 3 / 10
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		if e, err := strconv.Atoi(s[i+1:]); err != nil || e > maxExp || e < -maxExp {
+			return nil
+		}
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || !ratFits(r) {
+		return nil
+	}
+	return r
+}
+
+// ratFits reports whether r is small enough to be an untyped rational.
+func ratFits(r *big.Rat) bool {
+	return r.Num().BitLen() <= maxUntypedBits && r.Denom().BitLen() <= maxUntypedBits
+}
+
+// ratNum returns r as an untyped rational.
+func ratNum(r *big.Rat) Num {
+	if !ratFits(r) {
+		panic(errRatTooLarge)
+	}
+	return Num{r, false}
+}
+
+// untypedRats reports whether nums are all untyped rationals or integers, and
+// at least one of them is a rational.
+func untypedRats(nums ...Num) bool {
+	rat := false
+	for _, num := range nums {
+		_, ok := num.val.(*big.Rat)
+		if !ok && !untypedInts(num) {
+			return false
+		}
+		rat = rat || ok
+	}
+	return rat
+}
+
+// ratOperand converts the rational x to the format of other if other is a
+// float or fixed point value, like Go converts untyped constants to the type
+// of the other operand. This rounds x once, rather than rounding it to float64
+// first.
+func ratOperand(x, other Num) Num {
+	r, ok := x.val.(*big.Rat)
+	switch {
+	case !ok:
+		return x
+	case fixedPoint(other):
+		return Num{other.val.(Fixed).Q.FromRat(r), false}
+	case other.CanFloat() && !untypedRats(other):
+		f := floatFormat(other)
+		return floatNum(f, f.RoundRat(r), false)
+	}
+	return x
+}
+
+type RatBinary func(z, x, y *big.Rat) *big.Rat
+
+// quoRat divides x by y, or returns nil if y is zero to leave the division to
+// float64, which gives an infinity or NaN.
+func quoRat(z, x, y *big.Rat) *big.Rat {
+	if y.Sign() == 0 {
+		return nil
+	}
+	return z.Quo(x, y)
+}
+
+// expRat computes x**y exactly if y is an integer, or returns nil if y is not
+// an integer or the result is infinite.
+func expRat(z, x, y *big.Rat) *big.Rat {
+	if !y.IsInt() || !y.Num().IsInt64() {
+		return nil
+	}
+	k := y.Num().Int64()
+	if k < 0 {
+		if x.Sign() == 0 {
+			return nil
+		}
+		x = new(big.Rat).Inv(x)
+		k = -k
+	}
+	// Check the size of the result before computing it.
+	bits := max(x.Num().BitLen(), x.Denom().BitLen())
+	if bits > 1 && k > maxUntypedBits/int64(bits-1) {
+		panic(errRatTooLarge)
+	}
+	num := new(big.Int).Exp(x.Num(), big.NewInt(k), nil)
+	den := new(big.Int).Exp(x.Denom(), big.NewInt(k), nil)
+	return z.SetFrac(num, den)
+}
+
+// ldexpRat returns r multiplied by 2**e.
+func ldexpRat(r *big.Rat, e int) *big.Rat {
+	if e > maxUntypedBits || e < -maxUntypedBits {
+		panic(errRatTooLarge)
+	}
+	num := new(big.Int).Set(r.Num())
+	den := new(big.Int).Set(r.Denom())
+	if e >= 0 {
+		num.Lsh(num, uint(e))
+	} else {
+		den.Lsh(den, uint(-e))
+	}
+	return new(big.Rat).SetFrac(num, den)
+}
+
+// maxRepeatDigits limits the search for the repeating digits of a decimal
+// expansion.
+const maxRepeatDigits = 1000
+
+// exactDecimal returns the decimal expansion of r. Repeating digits are
+// enclosed in parentheses, and expansions which don't repeat within
+// maxRepeatDigits digits are cut short with "...".
+func exactDecimal(r *big.Rat) string {
+	// The digits before any repeating ones are as many as the larger count of
+	// factors of 2 or 5 in the denominator.
+	den := new(big.Int).Set(r.Denom())
+	twos := int(den.TrailingZeroBits())
+	den.Rsh(den, uint(twos))
+	fives := 0
+	five := big.NewInt(5)
+	for m := new(big.Int); ; fives++ {
+		q, _ := new(big.Int).QuoRem(den, five, m)
+		if m.Sign() != 0 {
+			break
+		}
+		den = q
+	}
+	places := max(twos, fives)
+
+	ten := big.NewInt(10)
+	num := new(big.Int).Abs(r.Num())
+	num.Mul(num, new(big.Int).Exp(ten, big.NewInt(int64(places)), nil))
+	q, rem := num.QuoRem(num, r.Denom(), new(big.Int))
+	s := q.String()
+	if len(s) <= places {
+		s = strings.Repeat("0", places-len(s)+1) + s
+	}
+	if places > 0 {
+		s = s[:len(s)-places] + "." + s[len(s)-places:]
+	}
+	if r.Sign() < 0 {
+		s = "-" + s
+	}
+	if rem.Sign() == 0 {
+		return s
+	}
+	if places == 0 {
+		s += "."
+	}
+
+	// From here the remainders, and so the digits, repeat from the first.
+	first := new(big.Int).Set(rem)
+	var digits []byte
+	for {
+		d := new(big.Int)
+		d.QuoRem(rem.Mul(rem, ten), r.Denom(), rem)
+		digits = append(digits, byte('0'+d.Int64()))
+		if rem.Cmp(first) == 0 {
+			return fmt.Sprintf("%s(%s)", s, digits)
+		}
+		if len(digits) == maxRepeatDigits {
+			return fmt.Sprintf("%s%s...", s, digits)
+		}
+	}
+}
+
+// ratError returns the value of r rounded to f and the error introduced.
+func ratError(f *FloatFormat, r *big.Rat) string {
+	b := f.RoundRat(r)
+	if f.IsInf(b) || f.IsNaN(b) {
+		return f.Format(b) + " (overflow)"
+	}
+	x := f.Decode(b)
+	rounded, _ := x.Rat(nil)
+	diff := new(big.Rat).Sub(rounded, r)
+	// The spacing of values around the result, in the binade of the result
+	// or the subnormal range.
+	e := f.minExp()
+	if x.Sign() != 0 {
+		e = max(x.MantExp(nil)-1, e)
+	}
+	err, _ := diff.Float64()
+	ulps, _ := ldexpRat(diff, f.Man-e).Float64()
+	return fmt.Sprintf("%s (error %.4g, %.4g ulp)", exactDecimal(rounded), err, ulps)
+}
+
+// formatRat returns the verbose description of the rational r, including the
+// errors introduced by converting it to f32 and f64.
+func formatRat(r *big.Rat) string {
+	return formatTable(
+		"type", "rational",
+		"dec", exactDecimal(r),
+		"frac", r.RatString(),
+		"f32", ratError(Binary32, r),
+		"f64", ratError(Binary64, r),
+	)
+}
+
+// exactRows returns the exact decimal expansion of the float n in exact mode.
+func exactRows(n Num) []string {
+	f, b := floatFormat(n), floatBits(n)
+	if !exactMode || f.IsNaN(b) || f.IsInf(b) {
+		return nil
+	}
+	r, _ := f.Decode(b).Rat(nil)
+	return []string{"exact", exactDecimal(r)}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// QFormat describes a fixed point format in Q notation. Int counts the
+// integer bits, including the sign bit of signed formats, and Frac the
+// fractional bits. q15 is short for q1.15 and uq8 for uq0.8.
+type QFormat struct {
+	Int    int
+	Frac   int
+	Signed bool
+}
+
+func NewQFormat(intBits, frac int, signed bool) (QFormat, error) {
+	q := QFormat{intBits, frac, signed}
+	switch {
+	case signed && intBits < 1:
+		return q, fmt.Errorf("%s: signed formats need an integer bit for the sign", q)
+	case q.Bits() < 1 || q.Bits() > 64:
+		return q, fmt.Errorf("%s: fixed point formats must be from 1 to 64 bits wide", q)
+	}
+	return q, nil
+}
+
+func (q QFormat) Bits() int {
+	return q.Int + q.Frac
+}
+
+func (q QFormat) String() string {
+	if q.Signed {
+		return fmt.Sprintf("q%d.%d", q.Int, q.Frac)
+	}
+	return fmt.Sprintf("uq%d.%d", q.Int, q.Frac)
+}
+
+// rawRange returns the smallest and largest raw integers of the format.
+func (q QFormat) rawRange() (*big.Int, *big.Int) {
+	if q.Signed {
+		hi := new(big.Int).Lsh(big1, uint(q.Bits()-1))
+		return new(big.Int).Neg(hi), hi.Sub(hi, big1)
+	}
+	hi := new(big.Int).Lsh(big1, uint(q.Bits()))
+	return new(big.Int), hi.Sub(hi, big1)
+}
+
+// Fixed is a fixed point value. Raw holds the low bits of the underlying
+// integer and Err the error introduced by rounding and saturating the result
+// of the operation which produced the value.
+type Fixed struct {
+	Q   QFormat
+	Raw uint64
+	Err float64
+}
+
+// FromRaw returns the value whose underlying integer has the low bits of raw.
+func (q QFormat) FromRaw(raw uint64) Fixed {
+	return Fixed{q, raw & (1<<q.Bits() - 1), 0}
+}
+
+// FromRat converts r to the format. The result is rounded to nearest, with
+// ties rounded up like rounding shift instructions, and saturated.
+func (q QFormat) FromRat(r *big.Rat) Fixed {
+	scaled := new(big.Rat).SetFrac(new(big.Int).Lsh(r.Num(), uint(q.Frac)), r.Denom())
+	scaled.Add(scaled, big.NewRat(1, 2))
+	raw := new(big.Int).Div(scaled.Num(), scaled.Denom())
+	lo, hi := q.rawRange()
+	if raw.Cmp(lo) < 0 {
+		raw = lo
+	} else if raw.Cmp(hi) > 0 {
+		raw = hi
+	}
+	x := q.FromRaw(Uint128FromBig(raw).Lo)
+	x.Err, _ = new(big.Rat).Sub(x.Rat(), r).Float64()
+	return x
+}
+
+// FromBigFloat is like FromRat, but saturates infinities.
+func (q QFormat) FromBigFloat(f *big.Float) Fixed {
+	if f.IsInf() {
+		lo, hi := q.rawRange()
+		x := q.FromRaw(Uint128FromBig(hi).Lo)
+		if f.Signbit() {
+			x = q.FromRaw(Uint128FromBig(lo).Lo)
+		}
+		x.Err, _ = new(big.Float).Neg(f).Float64()
+		return x
+	}
+	r, _ := f.Rat(nil)
+	return q.FromRat(r)
+}
+
+// FromNum converts n to the format.
+func (q QFormat) FromNum(n Num) Fixed {
+	if v, ok := n.val.(Fixed); ok && v.Q == q {
+		return v
+	}
+	if n.IsNaN() {
+		panic(fmt.Errorf("%s has no NaN", q))
+	}
+	if r, ok := n.val.(*big.Rat); ok {
+		return q.FromRat(r)
+	}
+	return q.FromBigFloat(n.AsBigFloat())
+}
+
+// Int returns the underlying integer.
+func (x Fixed) Int() *big.Int {
+	i := new(big.Int).SetUint64(x.Raw)
+	if x.Q.Signed && i.Bit(x.Q.Bits()-1) == 1 {
+		i.Sub(i, new(big.Int).Lsh(big1, uint(x.Q.Bits())))
+	}
+	return i
+}
+
+// Rat returns the exact value of x.
+func (x Fixed) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(x.Int(), new(big.Int).Lsh(big1, uint(x.Q.Frac)))
+}
+
+// String returns the shortest decimal representation of x which converts
+// back to x without saturating.
+func (x Fixed) String() string {
+	r := x.Rat()
+	halfLSB := new(big.Rat).SetFrac(big1, new(big.Int).Lsh(big1, uint(x.Q.Frac+1)))
+	pow := big.NewRat(1, 1)
+	for places := 0; ; places++ {
+		// Round to the given number of decimal places, ties up.
+		scaled := new(big.Rat).Mul(r, pow)
+		scaled.Add(scaled, big.NewRat(1, 2))
+		d := new(big.Rat).SetFrac(new(big.Int).Div(scaled.Num(), scaled.Denom()), pow.Num())
+		diff := new(big.Rat).Sub(d, r)
+		if x.Q.FromRat(d).Raw == x.Raw && diff.Abs(diff).Cmp(halfLSB) <= 0 {
+			return d.FloatString(places)
+		}
+		pow.Mul(pow, big.NewRat(10, 1))
+	}
+}
+
+// exact returns the full decimal expansion of x.
+func (x Fixed) exact() string {
+	s := x.Rat().FloatString(x.Q.Frac)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// fixedPoint reports whether any of nums is a Fixed.
+func fixedPoint(nums ...Num) bool {
+	for _, num := range nums {
+		if _, ok := num.val.(Fixed); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// outFixed returns the format for the result of an operation on nums, of
+// which at least one is fixed point. Mixing fixed point formats is an error.
+func outFixed(nums ...Num) QFormat {
+	var out *QFormat
+	for _, num := range nums {
+		if v, ok := num.val.(Fixed); ok {
+			if out != nil && *out != v.Q {
+				panic(fmt.Errorf("mismatched fixed point formats %s and %s", *out, v.Q))
+			}
+			out = &v.Q
+		}
+	}
+	return *out
+}
+
+// fixedBinary applies fn to the exact values of n and m, rounding and
+// saturating the result.
+func fixedBinary(n, m Num, fn FloatBinary) (out Num) {
+	q := outFixed(n, m)
+	if n.IsNaN() || m.IsNaN() {
+		panic(fmt.Errorf("%s has no NaN", q))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(big.ErrNaN); !ok {
+				panic(r)
+			}
+			panic(fmt.Errorf("%s has no NaN", q))
+		}
+	}()
+	// Enough bits to hold sums and products of fixed point values exactly
+	// and to round quotients correctly.
+	z := new(big.Float).SetPrec(256)
+	z = fn(z, n.AsBigFloat(), m.AsBigFloat())
+	return Num{q.FromBigFloat(z), true}
+}
+
+// fixedUnary is fixedBinary for functions of one value.
+func fixedUnary(n Num, fn FloatUnary) (out Num) {
+	q := n.val.(Fixed).Q
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(big.ErrNaN); !ok {
+				panic(r)
+			}
+			panic(fmt.Errorf("%s has no NaN", q))
+		}
+	}()
+	z := new(big.Float).SetPrec(256)
+	z = fn(z, n.AsBigFloat())
+	return Num{q.FromBigFloat(z), true}
+}
+
+// formatFixed returns the verbose description of x.
+func formatFixed(x Fixed, typ string) string {
+	bits := x.Q.Bits()
+	return formatTable(
+		"type", typ,
+		"dec", x.String(),
+		"exact", x.exact(),
+		"raw", x.Int().String(),
+		"hex", fmt.Sprintf("%#0*x", (bits+3)/4, x.Raw),
+		"bin", fmt.Sprintf("%#0*b", bits, x.Raw),
+		"error", fmt.Sprintf("%.4g (%.4g lsb)", x.Err, math.Ldexp(x.Err, x.Q.Frac)),
+	)
+}
@@ -0,0 +1,641 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Specials describes how a format encodes infinities and NaNs.
+type Specials int
+
+const (
+	// IEEE formats reserve the largest exponent for infinities (zero
+	// mantissa) and NaNs (non-zero mantissa).
+	IEEE Specials = iota
+	// FN formats have no infinities. The largest exponent holds finite values
+	// except when the mantissa is all ones, which is NaN.
+	FN
+	// X87 formats are IEEE formats which store the leading mantissa bit
+	// explicitly. Encodings where it disagrees with the exponent, other than
+	// pseudo-denormals, are invalid and treated as NaNs.
+	X87
+	// Finite formats have neither infinities nor NaNs. The largest exponent
+	// holds finite values.
+	Finite
+)
+
+// FloatFormat describes a binary floating point format with IEEE 754 style
+// encodings for zero and subnormals. The leading mantissa bit is implicit
+// except in X87 formats.
+type FloatFormat struct {
+	Name     string
+	Exp      int // Exponent bits
+	Man      int // Mantissa bits, excluding the leading bit
+	Bias     int
+	Specials Specials
+}
+
+var (
+	Binary32 = &FloatFormat{"float32", 8, 23, 127, IEEE}
+	Binary64 = &FloatFormat{"float64", 11, 52, 1023, IEEE}
+	Float16  = &FloatFormat{"float16", 5, 10, 15, IEEE}
+	BFloat16 = &FloatFormat{"bfloat16", 8, 7, 127, IEEE}
+	E4M3     = &FloatFormat{"e4m3", 4, 3, 7, FN}
+	E5M2     = &FloatFormat{"e5m2", 5, 2, 15, IEEE}
+	Float80  = &FloatFormat{"float80", 15, 63, 16383, X87}
+	Float128 = &FloatFormat{"float128", 15, 112, 16383, IEEE}
+)
+
+// formats holds the formats defined with the fmt command, by name.
+var formats = map[string]*FloatFormat{}
+
+// NewFloatFormat returns a format with the given layout. A bias of nil
+// selects the IEEE 754 bias for the exponent width.
+func NewFloatFormat(name string, exp, man int, bias *int, specials Specials) (*FloatFormat, error) {
+	f := &FloatFormat{name, exp, man, 1<<max(exp-1, 0) - 1, specials}
+	if bias != nil {
+		f.Bias = *bias
+	}
+	switch {
+	case exp < 1 || exp > 30:
+		return nil, fmt.Errorf("%s: exponent bits must be from 1 to 30", name)
+	case man < 0:
+		return nil, fmt.Errorf("%s: mantissa bits must not be negative", name)
+	case man < 1 && (specials == IEEE || specials == X87):
+		return nil, fmt.Errorf("%s: formats with infinities need mantissa bits", name)
+	case f.Bits() > 128:
+		return nil, fmt.Errorf("%s: formats may be at most 128 bits wide", name)
+	case f.Bias <= -1<<30 || f.Bias >= 1<<30:
+		return nil, fmt.Errorf("%s: bias out of range", name)
+	}
+	return f, nil
+}
+
+// Float is a value in a FloatFormat other than float32 or float64, which are
+// represented using Go's native types.
+type Float struct {
+	F    *FloatFormat
+	Bits Uint128
+}
+
+// Bits returns the total width of the format.
+func (f *FloatFormat) Bits() int {
+	return 1 + f.Exp + f.explicit() + f.Man
+}
+
+// explicit returns the number of stored leading mantissa bits.
+func (f *FloatFormat) explicit() int {
+	if f.Specials == X87 {
+		return 1
+	}
+	return 0
+}
+
+// Precision returns the number of significant bits of normal values.
+func (f *FloatFormat) Precision() int {
+	return f.Man + 1
+}
+
+func (f *FloatFormat) maxExp() uint64 {
+	return 1<<f.Exp - 1
+}
+
+func (f *FloatFormat) minExp() int {
+	return 1 - f.Bias
+}
+
+// Fields splits b into its sign, biased exponent and mantissa fields. The
+// mantissa excludes the leading bit, even when it is explicit.
+func (f *FloatFormat) Fields(b Uint128) (sign uint, exp uint64, man *big.Int) {
+	sign = uint(b.Shr(uint(f.Bits()-1)).Lo & 1)
+	exp = b.Shr(uint(f.Man+f.explicit())).Lo & f.maxExp()
+	man = b.Trunc(f.Man).Big()
+	return
+}
+
+// Lead returns the leading mantissa bit of b.
+func (f *FloatFormat) Lead(b Uint128) uint {
+	if f.Specials == X87 {
+		return uint(b.Shr(uint(f.Man)).Lo & 1)
+	}
+	if _, exp, _ := f.Fields(b); exp != 0 {
+		return 1
+	}
+	return 0
+}
+
+// join builds an encoding from a sign and a magnitude with an implicit
+// leading bit.
+func (f *FloatFormat) join(sign uint, mag *big.Int) Uint128 {
+	if f.Specials == X87 && mag.BitLen() > f.Man {
+		// Make room for the leading bit, which is set whenever the exponent is
+		// non-zero.
+		man := new(big.Int).And(mag, f.manMask())
+		mag = new(big.Int).Rsh(mag, uint(f.Man))
+		mag.Lsh(mag, uint(f.Man+1)).SetBit(mag, f.Man, 1).Or(mag, man)
+	}
+	return Uint128FromBig(new(big.Int).SetBit(mag, f.Bits()-1, sign))
+}
+
+func (f *FloatFormat) IsNaN(b Uint128) bool {
+	_, exp, man := f.Fields(b)
+	switch f.Specials {
+	case Finite:
+		return false
+	case FN:
+		return exp == f.maxExp() && man.Cmp(f.manMask()) == 0
+	case X87:
+		// Unnormals, pseudo-infinities and pseudo-NaNs are all invalid.
+		return exp != 0 && f.Lead(b) == 0 || exp == f.maxExp() && man.Sign() != 0
+	default:
+		return exp == f.maxExp() && man.Sign() != 0
+	}
+}
+
+func (f *FloatFormat) IsInf(b Uint128) bool {
+	_, exp, man := f.Fields(b)
+	return (f.Specials == IEEE || f.Specials == X87) &&
+		exp == f.maxExp() && man.Sign() == 0 && f.Lead(b) == 1
+}
+
+// NaN returns the default quiet NaN. It panics if the format has no NaNs.
+func (f *FloatFormat) NaN() Uint128 {
+	top := new(big.Int).Lsh(new(big.Int).SetUint64(f.maxExp()), uint(f.Man))
+	switch f.Specials {
+	case Finite:
+		panic(fmt.Errorf("%s has no NaN", f.Name))
+	case FN:
+		return f.join(0, top.Add(top, f.manMask()))
+	default:
+		return f.join(0, top.SetBit(top, f.Man-1, 1))
+	}
+}
+
+// MakeNaN returns the quiet or signaling NaN with the given payload, the
+// mantissa bits below the quiet bit.
+func (f *FloatFormat) MakeNaN(payload *big.Int, signaling bool) (Uint128, error) {
+	switch {
+	case f.Specials == Finite:
+		return Uint128{}, fmt.Errorf("%s has no NaN", f.Name)
+	case f.Specials == FN && signaling:
+		return Uint128{}, fmt.Errorf("%s has no signaling NaN", f.Name)
+	case f.Specials == FN && payload.Sign() != 0:
+		return Uint128{}, fmt.Errorf("%s NaN has no payload", f.Name)
+	case f.Specials == FN:
+		return f.NaN(), nil
+	case payload.Sign() < 0 || payload.BitLen() > f.Man-1:
+		return Uint128{}, fmt.Errorf("NaN payload %v out of range of %s", payload, f.Name)
+	case signaling && payload.Sign() == 0:
+		return Uint128{}, errors.New("signaling NaN needs a non-zero payload")
+	}
+	top := new(big.Int).Lsh(new(big.Int).SetUint64(f.maxExp()), uint(f.Man))
+	top.Or(top, payload)
+	if !signaling {
+		top.SetBit(top, f.Man-1, 1)
+	}
+	return f.join(0, top), nil
+}
+
+// Payload returns the payload of the NaN b, the mantissa bits below the quiet
+// bit. The NaN of FN formats has none.
+func (f *FloatFormat) Payload(b Uint128) *big.Int {
+	_, _, man := f.Fields(b)
+	if f.Specials == FN {
+		return new(big.Int)
+	}
+	return man.SetBit(man, f.Man-1, 0)
+}
+
+// NaNFrom returns the NaN of f converted from the NaN b of format g, as x86 and
+// ARM do. The sign and the most significant bits of the payload are kept, and
+// signaling NaNs become quiet. Formats without payloads give their default
+// NaN with the sign of b.
+func (f *FloatFormat) NaNFrom(g *FloatFormat, b Uint128) Uint128 {
+	sign, _, man := g.Fields(b)
+	_, mag := f.split(f.NaN())
+	if f.Specials != FN && g.Specials != FN {
+		if shift := f.Man - g.Man; shift >= 0 {
+			man.Lsh(man, uint(shift))
+		} else {
+			man.Rsh(man, uint(-shift))
+		}
+		mag.AndNot(mag, f.manMask()).Or(mag, man.SetBit(man, f.Man-1, 1))
+	}
+	return f.join(sign, mag)
+}
+
+// Inf returns the encoding of an infinity. Formats without infinities return
+// NaN, or the largest finite value if they have no NaNs either.
+func (f *FloatFormat) Inf(sign uint) Uint128 {
+	switch f.Specials {
+	case Finite:
+		return f.join(sign, f.MaxFinite())
+	case FN:
+		return f.NaN()
+	default:
+		return f.join(sign, new(big.Int).Lsh(new(big.Int).SetUint64(f.maxExp()), uint(f.Man)))
+	}
+}
+
+// MaxFinite returns the magnitude of the largest finite value's encoding.
+func (f *FloatFormat) MaxFinite() *big.Int {
+	top := new(big.Int).Lsh(new(big.Int).SetUint64(f.maxExp()), uint(f.Man))
+	switch f.Specials {
+	case Finite:
+		return top.Add(top, f.manMask())
+	case FN:
+		return top.Add(top, f.manMask()).Sub(top, big1)
+	default:
+		return top.Sub(top, big1)
+	}
+}
+
+// MinNormal returns the encoding of the smallest positive normal value.
+func (f *FloatFormat) MinNormal() Uint128 {
+	return f.join(0, new(big.Int).Lsh(big1, uint(f.Man)))
+}
+
+func (f *FloatFormat) manMask() *big.Int {
+	return new(big.Int).Sub(new(big.Int).Lsh(big1, uint(f.Man)), big1)
+}
+
+// overflow returns the result of rounding a value too large to represent.
+// When saturating, the result is the largest finite value of the same sign.
+func (f *FloatFormat) overflow(sign uint, sat bool) Uint128 {
+	if sat {
+		return f.join(sign, f.MaxFinite())
+	}
+	return f.Inf(sign)
+}
+
+// Decode returns the exact value of b, which must not be a NaN.
+func (f *FloatFormat) Decode(b Uint128) *big.Float {
+	sign, exp, man := f.Fields(b)
+	x := new(big.Float).SetPrec(uint(f.Precision()))
+	switch {
+	case f.IsInf(b):
+		x.SetInf(sign != 0)
+		return x
+	default:
+		// Subnormals share the exponent of the smallest normals.
+		man.SetBit(man, f.Man, f.Lead(b))
+		x.SetInt(man)
+		x.SetMantExp(x, max(int(exp), 1)-f.Bias-f.Man)
+	}
+	if sign != 0 {
+		x.Neg(x)
+	}
+	return x
+}
+
+// Round returns the encoding of x rounded to nearest, ties to even. Values too
+// large for the format become infinities, or NaN if the format has none.
+func (f *FloatFormat) Round(x *big.Float) Uint128 {
+	return f.round(x, false)
+}
+
+// RoundSat is like Round, but values too large for the format, including
+// infinities, saturate to the largest finite value.
+func (f *FloatFormat) RoundSat(x *big.Float) Uint128 {
+	return f.round(x, true)
+}
+
+func (f *FloatFormat) round(x *big.Float, sat bool) Uint128 {
+	var sign uint
+	if x.Signbit() {
+		sign = 1
+	}
+	if x.IsInf() {
+		return f.overflow(sign, sat)
+	}
+	// Values far out of range are settled from their exponent, since their
+	// rationals may be huge.
+	switch e := x.MantExp(nil); {
+	case x.Sign() == 0 || e < f.minExp()-f.Man-1:
+		return f.join(sign, new(big.Int))
+	case e > f.maxBinade()+1:
+		return f.overflow(sign, sat)
+	}
+	r, _ := x.Rat(nil)
+	return f.roundRat(r, sat)
+}
+
+// maxBinade returns the exponent e of the largest binade [2**e, 2**(e+1))
+// holding finite values, or which would hold them if the largest exponent
+// didn't encode specials.
+func (f *FloatFormat) maxBinade() int {
+	return int(f.maxExp()) - f.Bias
+}
+
+// RoundRat returns the encoding of r rounded to nearest, ties to even.
+func (f *FloatFormat) RoundRat(r *big.Rat) Uint128 {
+	return f.roundRat(r, false)
+}
+
+func (f *FloatFormat) roundRat(r *big.Rat, sat bool) Uint128 {
+	var sign uint
+	if r.Sign() < 0 {
+		sign = 1
+	}
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+	if num.Sign() == 0 {
+		return f.join(sign, num)
+	}
+
+	// Find e such that 2**e <= |r| < 2**(e+1).
+	e := num.BitLen() - den.BitLen()
+	if shiftCmp(num, den, e) < 0 {
+		e--
+	}
+	if e > f.maxBinade() {
+		return f.overflow(sign, sat)
+	}
+
+	// Scale |r| so that its integer part holds every representable bit.
+	q := max(e, f.minExp()) - f.Man
+	n, rem := shiftDiv(num, den, q)
+	half := new(big.Int).Lsh(rem, 1)
+	switch c := half.Cmp(shiftDen(den, q)); {
+	case c > 0, c == 0 && n.Bit(0) == 1:
+		n.Add(n, big1)
+	}
+
+	// Normal values have their leading bit carried into the exponent field,
+	// which also handles rounding up into the next binade.
+	biased := int64(max(e, f.minExp()) + f.Bias)
+	mag := new(big.Int).Lsh(big.NewInt(biased-1), uint(f.Man))
+	mag.Add(mag, n)
+	if mag.Cmp(f.MaxFinite()) > 0 {
+		return f.overflow(sign, sat)
+	}
+	return f.join(sign, mag)
+}
+
+// shiftCmp compares num with den * 2**e.
+func shiftCmp(num, den *big.Int, e int) int {
+	if e >= 0 {
+		return num.Cmp(new(big.Int).Lsh(den, uint(e)))
+	}
+	return new(big.Int).Lsh(num, uint(-e)).Cmp(den)
+}
+
+func shiftDen(den *big.Int, q int) *big.Int {
+	if q > 0 {
+		return new(big.Int).Lsh(den, uint(q))
+	}
+	return den
+}
+
+// shiftDiv divides num by den * 2**q, returning the quotient and remainder.
+func shiftDiv(num, den *big.Int, q int) (*big.Int, *big.Int) {
+	if q < 0 {
+		num = new(big.Int).Lsh(num, uint(-q))
+	}
+	return new(big.Int).QuoRem(num, shiftDen(den, q), new(big.Int))
+}
+
+// Ldexp returns b multiplied by 2**e, rounding to nearest.
+func (f *FloatFormat) Ldexp(b Uint128, e int) Uint128 {
+	if f.IsNaN(b) {
+		return b
+	}
+	x := f.Decode(b)
+	return f.Round(x.SetMantExp(x, e))
+}
+
+// FromNum converts n to the format, rounding to nearest. NaNs keep what
+// they can of their payload, as NaNFrom describes.
+func (f *FloatFormat) FromNum(n Num) Uint128 {
+	if n.IsNaN() {
+		return f.NaNFrom(floatFormat(n), floatBits(n))
+	}
+	if r, ok := n.val.(*big.Rat); ok {
+		return f.RoundRat(r)
+	}
+	return f.Round(n.AsBigFloat())
+}
+
+// FromNumSat converts n to the format, rounding to nearest and saturating
+// out of range values.
+func (f *FloatFormat) FromNumSat(n Num) Uint128 {
+	if n.IsNaN() {
+		return f.NaNFrom(floatFormat(n), floatBits(n))
+	}
+	if r, ok := n.val.(*big.Rat); ok {
+		return f.roundRat(r, true)
+	}
+	return f.RoundSat(n.AsBigFloat())
+}
+
+func (x Float) String() string {
+	return x.F.Format(x.Bits)
+}
+
+// Format returns the shortest decimal representation of b which rounds back
+// to b, formatted like strconv.FormatFloat's 'g' format.
+func (f *FloatFormat) Format(b Uint128) string {
+	if f.IsNaN(b) {
+		return "NaN"
+	}
+	x := f.Decode(b)
+	if x.IsInf() || x.Sign() == 0 {
+		return x.Text('g', -1)
+	}
+	// Compare against the canonical encoding, which differs from b for
+	// pseudo-denormals.
+	want := f.Round(x)
+	for digits := 1; ; digits++ {
+		s := x.Text('e', digits-1)
+		r, _ := new(big.Rat).SetString(s)
+		if f.RoundRat(r) != want {
+			continue
+		}
+		exp, _ := strconv.Atoi(s[strings.IndexByte(s, 'e')+1:])
+		if exp < -4 || exp >= 6 {
+			return s
+		}
+		y := new(big.Float).SetPrec(uint(4*digits + 64)).SetRat(r)
+		return y.Text('f', max(digits-1-exp, 0))
+	}
+}
+
+// Digits returns the number of significant decimal digits used when
+// printing values of the format in full.
+func (f *FloatFormat) Digits() int {
+	return int(math.Ceil(float64(f.Precision())*math.Log10(2))) + 2
+}
+
+// floatNum returns a Num holding the value with the given encoding, using Go's
+// native float types where possible.
+func floatNum(f *FloatFormat, b Uint128, typed bool) Num {
+	switch f {
+	case Binary32:
+		return Num{math.Float32frombits(uint32(b.Lo)), typed}
+	case Binary64:
+		return Num{math.Float64frombits(b.Lo), typed}
+	default:
+		return Num{Float{f, b}, typed}
+	}
+}
+
+// floatFormat returns the format of n, which must be a float.
+func floatFormat(n Num) *FloatFormat {
+	switch val := n.val.(type) {
+	case float32:
+		return Binary32
+	case float64:
+		return Binary64
+	case Float:
+		return val.F
+	default:
+		panic("not a float")
+	}
+}
+
+// floatBits returns the encoding of n, which must be a float.
+func floatBits(n Num) Uint128 {
+	if val, ok := n.val.(Float); ok {
+		return val.Bits
+	}
+	return Uint128{0, n.AsBits()}
+}
+
+// outFloat picks the format for the result of an operation on nums, of which
+// at least one is a float. Typed operands take priority, then the format with
+// the most precision.
+func outFloat(nums ...Num) (*FloatFormat, bool) {
+	var best *FloatFormat
+	typed := false
+	for _, num := range nums {
+		if !num.CanFloat() {
+			continue
+		}
+		f := floatFormat(num)
+		switch {
+		case best == nil || num.typed && !typed:
+			best, typed = f, num.typed
+		case num.typed == typed:
+			best = widerFloat(best, f)
+		}
+	}
+	_, typed = outBits(nums...)
+	return best, typed
+}
+
+// widerFloat returns whichever of f and g has the exponent and mantissa widths
+// to hold the values of the other, preferring f. Failing that it returns the
+// narrowest of the IEEE formats holding both, so float16 and bfloat16 give
+// float32.
+func widerFloat(f, g *FloatFormat) *FloatFormat {
+	switch {
+	case f.Exp >= g.Exp && f.Man >= g.Man:
+		return f
+	case g.Exp >= f.Exp && g.Man >= f.Man:
+		return g
+	}
+	for _, h := range []*FloatFormat{Float16, Binary32, Binary64, Float128} {
+		if h.Exp >= max(f.Exp, g.Exp) && h.Man >= max(f.Man, g.Man) {
+			return h
+		}
+	}
+	panic(fmt.Errorf("no float format holds both %s and %s", f.Name, g.Name))
+}
+
+// FloatBinary sets z to the result of an operation on x and y, rounded to
+// nearest or to odd at z's precision.
+type FloatBinary func(z, x, y *big.Float) *big.Float
+
+// floatBinary applies fn to n and m with enough precision that rounding the
+// result to the output format is correctly rounded.
+func floatBinary(n, m Num, fn FloatBinary) Num {
+	f, typed := outFloat(n, m)
+	return roundBinary(f, typed, n, m, fn)
+}
+
+// roundBinary is like floatBinary, but with the output format given.
+func roundBinary(f *FloatFormat, typed bool, n, m Num, fn FloatBinary) (out Num) {
+	if n.IsNaN() || m.IsNaN() {
+		return floatNum(f, f.NaN(), typed)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(big.ErrNaN); !ok {
+				panic(r)
+			}
+			out = floatNum(f, f.NaN(), typed)
+		}
+	}()
+	// Rounding the exact result of +, -, * and / to 2p+2 bits and then to p
+	// bits is the same as rounding it to p bits once. Other operations round
+	// to odd, for which p+2 bits are enough.
+	z := new(big.Float).SetPrec(uint(2*f.Precision() + 3))
+	z = fn(z, n.AsBigFloat(), m.AsBigFloat())
+	return floatNum(f, f.Round(z), typed)
+}
+
+// formatFloat returns the verbose description of the float with encoding b.
+// Any extra key/value pairs are listed after the decimal forms.
+func formatFloat(f *FloatFormat, b Uint128, typ string, extra ...string) string {
+	signBit, expBits, manBits := f.Fields(b)
+	sign := "+"
+	if signBit == 1 {
+		sign = "-"
+	}
+	lead := f.Lead(b)
+	var man string
+	switch {
+	case f.IsInf(b):
+		man = "Inf"
+	case f.IsSignaling(b):
+		man = "sNaN"
+	case f.IsNaN(b):
+		man = "qNaN"
+	case lead == 0 && manBits.Sign() == 0:
+		man = "0"
+	default:
+		// Normal or subnormal
+		man = fmt.Sprintf("0b%d.%0*b", lead, f.Man, manBits)
+	}
+	man = strings.TrimRight(strings.TrimRight(man, "0"), ".")
+	man = fmt.Sprintf("%s (%s)", man, formatBig(manBits, 16, (f.Man+3)/4))
+
+	dec, hex, fixed := "NaN", "NaN", "NaN"
+	if f.IsNaN(b) {
+		kind := "quiet"
+		if f.IsSignaling(b) {
+			kind = "signaling"
+		}
+		dec = fmt.Sprintf("NaN (%s, payload %#x)", kind, f.Payload(b))
+	} else {
+		x := f.Decode(b)
+		dec = f.Format(b)
+		hex = x.Text('x', -1)
+		fixed = x.Text('e', f.Digits()-1)
+	}
+	// The explicit leading bit of X87 formats gets a column of its own.
+	leadBits := ""
+	if f.explicit() != 0 {
+		leadBits = fmt.Sprintf(" %01b", lead)
+	}
+	manField := ""
+	if f.Man > 0 {
+		manField = fmt.Sprintf(" %0*b", f.Man, manBits)
+	}
+	kvs := []string{
+		"type", typ,
+		"dec", dec,
+		"hex", hex,
+		"fixed", fixed,
+	}
+	kvs = append(kvs, extra...)
+	return formatTable(append(kvs,
+		"bits", formatBig(b.Big(), 16, (f.Bits()+3)/4),
+		"", fmt.Sprintf("0b%01b %0*b%s%s", signBit, f.Exp, expBits, leadBits, manField),
+		"", fmt.Sprintf("  %s %*d%*s %*s", sign, f.Exp, int64(expBits)-int64(f.Bias), len(leadBits), "", f.Man, man),
+	)...)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+// TestFloatRoundTrip checks that every non-NaN encoding of the small formats
+// decodes and re-encodes to itself, and that values halfway between adjacent
+// encodings round to even.
+func TestFloatRoundTrip(t *testing.T) {
+	for _, f := range []*FloatFormat{Float16, BFloat16, E4M3, E5M2} {
+		t.Run(f.Name, func(t *testing.T) {
+			for i := uint64(0); i < 1<<(f.Bits()-1)-1; i++ {
+				b := Uint128{0, i}
+				next := Uint128{0, i + 1}
+				if f.IsNaN(b) || f.IsNaN(next) {
+					continue
+				}
+				x := f.Decode(b)
+				if got := f.Round(x); got != b {
+					t.Fatalf("%#04x: round trip gave %#04x", i, got.Lo)
+				}
+				if f.Decode(next).IsInf() {
+					continue
+				}
+				mid := new(big.Float).SetPrec(64).Add(x, f.Decode(next))
+				mid.Quo(mid, big.NewFloat(2))
+				want := b
+				if i%2 == 1 {
+					want = next
+				}
+				if got := f.Round(mid); got != want {
+					t.Fatalf("%#04x: midpoint rounded to %#04x", i, got.Lo)
+				}
+			}
+		})
+	}
+}
+
+// TestBFloat16FromFloat32 compares conversions from float32 against the usual
+// bit manipulation implementation of round to nearest even.
+func TestBFloat16FromFloat32(t *testing.T) {
+	for i := uint64(0); i < 1<<32; i += 0xfff1 {
+		f := math.Float32frombits(uint32(i))
+		if math.IsNaN(float64(f)) {
+			continue
+		}
+		want := (i + 0x7fff + (i>>16)&1) >> 16
+		got := BFloat16.FromNum(Num{f, false})
+		if got.Lo != want {
+			t.Fatalf("%#08x: got %#04x, want %#04x", i, got.Lo, want)
+		}
+	}
+}
+
+// float32Operands returns random float32 values for checking operations, with
+// special values and values near the boundaries of the format mixed in.
+func float32Operands(r *rand.Rand, n int) []float32 {
+	xs := []float32{
+		0, float32(math.Copysign(0, -1)), 1, -1, 0.5, 3,
+		float32(math.Inf(1)), float32(math.Inf(-1)), float32(math.NaN()),
+		math.MaxFloat32, -math.MaxFloat32, math.SmallestNonzeroFloat32, 0x1p-126, 0x1.fffffcp-127,
+	}
+	for len(xs) < n {
+		xs = append(xs, math.Float32frombits(r.Uint32()))
+	}
+	return xs
+}
+
+// sameFloat32 reports whether got holds the float32 want, counting all NaNs
+// as equal.
+func sameFloat32(got Num, want float32) bool {
+	g, ok := got.val.(float32)
+	if !ok {
+		return false
+	}
+	if want != want {
+		return g != g
+	}
+	return math.Float32bits(g) == math.Float32bits(want)
+}
+
+// TestFloat32Arithmetic compares arithmetic on float32 values against the
+// hardware.
+func TestFloat32Arithmetic(t *testing.T) {
+	ops := []struct {
+		name string
+		op   func(x, y Num) Num
+		want func(x, y float32) float32
+	}{
+		{"+", Num.OpAdd, func(x, y float32) float32 { return x + y }},
+		{"-", Num.OpSub, func(x, y float32) float32 { return x - y }},
+		{"*", Num.OpMul, func(x, y float32) float32 { return x * y }},
+		{"/", Num.OpDiv, func(x, y float32) float32 { return x / y }},
+	}
+	xs := float32Operands(rand.New(rand.NewSource(1)), 300)
+	for _, op := range ops {
+		for _, x := range xs {
+			for _, y := range xs {
+				got := op.op(Num{x, true}, Num{y, true})
+				if want := op.want(x, y); !sameFloat32(got, want) {
+					t.Fatalf("%g %g %s: got %v, want %g", x, y, op.name, got.val, want)
+				}
+			}
+		}
+	}
+}
+
+// TestFloat32Ldexp compares shifts of float32 values against exact results
+// rounded to nearest.
+func TestFloat32Ldexp(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for _, x := range float32Operands(r, 2000) {
+		shift := r.Intn(600) - 300
+		got := Num{x, true}.OpShl(Num{int64(shift), false})
+		want := float32(math.Ldexp(float64(x), shift))
+		if x == x && !math.IsInf(float64(x), 0) {
+			exact := new(big.Rat).SetFloat64(float64(x))
+			exact = ldexpRat(exact, shift)
+			want = math.Float32frombits(uint32(Binary32.RoundRat(exact).Lo))
+			if math.Signbit(float64(x)) && want == 0 {
+				want = float32(math.Copysign(0, -1))
+			}
+		}
+		if !sameFloat32(got, want) {
+			t.Fatalf("%g %d <<: got %v, want %g", x, shift, got.val, want)
+		}
+	}
+}
+
+// TestFloat32Next compares nextup, nextdown and ulpdiff on float32 values
+// against math.Nextafter32.
+func TestFloat32Next(t *testing.T) {
+	for _, x := range float32Operands(rand.New(rand.NewSource(3)), 2000) {
+		up := math.Nextafter32(x, float32(math.Inf(1)))
+		down := math.Nextafter32(x, float32(math.Inf(-1)))
+		if x == 0 {
+			// Nextafter32 keeps the sign of zero results.
+			up, down = math.SmallestNonzeroFloat32, -math.SmallestNonzeroFloat32
+		}
+		if got := (Num{x, true}).OpNextUp(); !sameFloat32(got, up) {
+			t.Fatalf("%g nextup: got %v, want %g", x, got.val, up)
+		}
+		if got := (Num{x, true}).OpNextDown(); !sameFloat32(got, down) {
+			t.Fatalf("%g nextdown: got %v, want %g", x, got.val, down)
+		}
+		if x != x || math.IsInf(float64(x), 0) {
+			continue
+		}
+		if got := (Num{up, true}).OpUlpDiff(Num{x, true}).AsBig(); got.Cmp(big1) != 0 {
+			t.Fatalf("%g %g ulpdiff: got %v, want 1", up, x, got)
+		}
+	}
+}
+
+// TestFloat32PowInt compares integer powers of float32 values against exact
+// results rounded to nearest.
+func TestFloat32PowInt(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 5000; i++ {
+		x := float32(math.Ldexp(r.Float64()+0.5, r.Intn(16)-8))
+		if r.Intn(2) == 0 {
+			x = -x
+		}
+		k := int64(r.Intn(61) - 30)
+		got := Num{x, true}.OpExp(Num{k, false})
+		exact := new(big.Rat).SetFloat64(float64(x))
+		num := new(big.Int).Exp(exact.Num(), big.NewInt(max(k, -k)), nil)
+		den := new(big.Int).Exp(exact.Denom(), big.NewInt(max(k, -k)), nil)
+		if k < 0 {
+			num, den = den, num
+		}
+		if den.Sign() < 0 {
+			num.Neg(num)
+			den.Neg(den)
+		}
+		exact.SetFrac(num, den)
+		want := math.Float32frombits(uint32(Binary32.RoundRat(exact).Lo))
+		if !sameFloat32(got, want) {
+			t.Fatalf("%g %d **: got %v, want %g", x, k, got.val, want)
+		}
+	}
+}
+
+// roundedPow returns math.Pow(x, y) rounded to f, and whether the float64
+// result is far enough from a rounding boundary of f for that to be the
+// correctly rounded result.
+func roundedPow(f *FloatFormat, x, y float64) (Uint128, bool) {
+	v := math.Pow(x, y)
+	if math.IsNaN(v) || math.IsInf(v, 0) || v == 0 {
+		return f.FromNum(Num{v, false}), true
+	}
+	lo := f.Round(big.NewFloat(v * (1 - 0x1p-40)))
+	hi := f.Round(big.NewFloat(v * (1 + 0x1p-40)))
+	return lo, lo == hi
+}
+
+// TestFloat32Pow compares powers of float32 values against float64 results,
+// skipping those too close to a rounding boundary to tell.
+func TestFloat32Pow(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	for i := 0; i < 5000; i++ {
+		x := float32(math.Ldexp(r.Float64()+0.5, r.Intn(40)-20))
+		y := float32(r.NormFloat64() * 8)
+		want, ok := roundedPow(Binary32, float64(x), float64(y))
+		if !ok {
+			continue
+		}
+		got := Num{x, true}.OpExp(Num{y, true})
+		if !sameFloat32(got, math.Float32frombits(uint32(want.Lo))) {
+			t.Fatalf("%g %g **: got %v, want %g", x, y, got.val, math.Float32frombits(uint32(want.Lo)))
+		}
+	}
+}
+
+// TestFloat16Pow compares powers of every float16 value against float64
+// results, skipping those too close to a rounding boundary to tell.
+func TestFloat16Pow(t *testing.T) {
+	for _, y := range []float64{-2.25, 1.0 / 3} {
+		yb := Float16.FromNum(Num{y, false})
+		yf, _ := Float16.Decode(yb).Float64()
+		for i := uint64(0); i < 1<<16; i++ {
+			b := Uint128{0, i}
+			if Float16.IsNaN(b) {
+				continue
+			}
+			x, _ := Float16.Decode(b).Float64()
+			want, ok := roundedPow(Float16, x, yf)
+			if !ok {
+				continue
+			}
+			got := Num{Float{Float16, b}, true}.OpExp(Num{Float{Float16, yb}, true})
+			if v := got.val.(Float); v.Bits != want && !(Float16.IsNaN(v.Bits) && Float16.IsNaN(want)) {
+				t.Fatalf("%g %g **: got %#04x, want %#04x", x, yf, v.Bits.Lo, want.Lo)
+			}
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// The fields of float encodings as stack values, and floats built from them.
+
+// IsSignaling reports whether b is a signaling NaN, one with the most
+// significant mantissa bit clear as in IEEE 754-2008. The NaN of FN formats is
+// quiet, and invalid X87 encodings are signaling.
+func (f *FloatFormat) IsSignaling(b Uint128) bool {
+	if !f.IsNaN(b) || f.Specials == FN {
+		return false
+	}
+	_, exp, man := f.Fields(b)
+	return exp != f.maxExp() || man.Bit(f.Man-1) == 0
+}
+
+// Float classes, numbered by their bit in the mask of RISC-V's FCLASS
+// instruction.
+const (
+	classNegInf = iota
+	classNegNormal
+	classNegSubnormal
+	classNegZero
+	classPosZero
+	classPosSubnormal
+	classPosNormal
+	classPosInf
+	classSignalingNaN
+	classQuietNaN
+)
+
+// classNames holds the names fclass shows for the float classes.
+var classNames = [...]string{
+	classNegInf:       "-inf",
+	classNegNormal:    "-normal",
+	classNegSubnormal: "-subnormal",
+	classNegZero:      "-zero",
+	classPosZero:      "+zero",
+	classPosSubnormal: "+subnormal",
+	classPosNormal:    "+normal",
+	classPosInf:       "+inf",
+	classSignalingNaN: "sNaN",
+	classQuietNaN:     "qNaN",
+}
+
+// Class returns the class of b.
+func (f *FloatFormat) Class(b Uint128) int {
+	switch {
+	case f.IsSignaling(b):
+		return classSignalingNaN
+	case f.IsNaN(b):
+		return classQuietNaN
+	}
+	sign, mag := f.split(b)
+	class := classPosNormal
+	switch {
+	case f.IsInf(b):
+		class = classPosInf
+	case mag.Sign() == 0:
+		class = classPosZero
+	case mag.BitLen() <= f.Man:
+		class = classPosSubnormal
+	}
+	if sign == 1 {
+		// The negative classes mirror the positive ones.
+		class = classNegZero + classPosZero - class
+	}
+	return class
+}
+
+// OpFclass returns the mask RISC-V's FCLASS gives for the class of the float
+// n, with the bit for the class set.
+func (n Num) OpFclass() Num {
+	n = floatOperand("fclass", n)
+	return Num{uint16(1) << floatFormat(n).Class(floatBits(n)), true}
+}
+
+// formatClass returns the description of the class of the float n, with its
+// mask.
+func formatClass(n Num) string {
+	n = floatOperand("fclass", n)
+	class := floatFormat(n).Class(floatBits(n))
+	return formatTable("class", classNames[class], "mask", fmt.Sprintf("%#x", 1<<class))
+}
+
+// OpPayload returns the payload of the NaN n, the mantissa bits below the
+// quiet bit.
+func (n Num) OpPayload() Num {
+	n = floatOperand("payload", n)
+	if !n.IsNaN() {
+		panic(fmt.Errorf("payload needs a NaN, not %v", n.concise()))
+	}
+	return untypedInt(floatFormat(n).Payload(floatBits(n)))
+}
+
+// OpSign returns the sign bit of the float n.
+func (n Num) OpSign() Num {
+	n = floatOperand("sign", n)
+	sign, _, _ := floatFormat(n).Fields(floatBits(n))
+	return Num{uint64(sign), false}
+}
+
+// OpExponent returns the biased exponent field of the float n.
+func (n Num) OpExponent() Num {
+	n = floatOperand("exponent", n)
+	_, exp, _ := floatFormat(n).Fields(floatBits(n))
+	return Num{exp, false}
+}
+
+// OpMantissa returns the mantissa field of the float n, without the leading
+// bit even when it is explicit.
+func (n Num) OpMantissa() Num {
+	n = floatOperand("mantissa", n)
+	_, _, man := floatFormat(n).Fields(floatBits(n))
+	return untypedInt(man)
+}
+
+// scaled returns x * 2**e in the format of n, which must be exact.
+func scaled(name string, n Num, x *big.Float, e int) Num {
+	f := floatFormat(n)
+	b := f.Round(new(big.Float).SetMantExp(x, e))
+	if f.Decode(b).Cmp(x.SetMantExp(x, e)) != 0 {
+		panic(fmt.Errorf("%s result out of range of %s", name, n.Type()))
+	}
+	return floatNum(f, b, n.typed)
+}
+
+// unnormalized reports whether the float n is a zero, an infinity or a NaN,
+// which have no normalized mantissa.
+func unnormalized(n Num) bool {
+	f, b := floatFormat(n), floatBits(n)
+	if f.IsNaN(b) || f.IsInf(b) {
+		return true
+	}
+	_, mag := f.split(b)
+	return mag.Sign() == 0
+}
+
+// OpFrexp splits n into a fraction with a magnitude in [0.5, 1) and a power of
+// 2, like C's frexp. Zeros, infinities and NaNs are returned with a power of 0.
+func (n Num) OpFrexp() (Num, Num) {
+	n = floatOperand("frexp", n)
+	if unnormalized(n) {
+		return n, Num{uint64(0), false}
+	}
+	x := n.AsBigFloat()
+	e := x.MantExp(x)
+	return scaled("frexp", n, x, 0), untypedInt(big.NewInt(int64(e)))
+}
+
+// OpSignificand returns n scaled by a power of 2 to a magnitude in [1, 2), the
+// normalized mantissa with its leading bit. Zeros, infinities and NaNs are
+// returned unchanged.
+func (n Num) OpSignificand() Num {
+	n = floatOperand("significand", n)
+	if unnormalized(n) {
+		return n
+	}
+	x := n.AsBigFloat()
+	x.MantExp(x)
+	return scaled("significand", n, x, 1)
+}
+
+// maxLdexp bounds the powers of 2 ldexp scales by, beyond which every format
+// overflows or underflows.
+const maxLdexp = 1 << 30
+
+// OpLdexp returns n * 2**m, rounded to the format of n.
+func (n Num) OpLdexp(m Num) Num {
+	requireInts("ldexp", m)
+	n = floatOperand("ldexp", n)
+	e := m.AsBig()
+	if !e.IsInt64() || e.Int64() > maxLdexp || e.Int64() < -maxLdexp {
+		e = big.NewInt(int64(e.Sign()) * maxLdexp)
+	}
+	return n.OpShl(Num{e.Int64(), false})
+}
+
+// OpMkfloat builds a float of format f from the sign, biased exponent and
+// mantissa fields.
+func (sign Num) OpMkfloat(exp, man Num, f *FloatFormat) Num {
+	requireInts("mkfloat", sign, exp, man)
+	field := func(name string, v Num, bits int) *big.Int {
+		x := v.AsBig()
+		if x.Sign() < 0 || x.BitLen() > bits {
+			panic(fmt.Errorf("mkfloat %s field %v out of range of %s", name, x, f.Name))
+		}
+		return x
+	}
+	s := field("sign", sign, 1)
+	mag := new(big.Int).Lsh(field("exponent", exp, f.Exp), uint(f.Man))
+	mag.Or(mag, field("mantissa", man, f.Man))
+	return floatNum(f, f.join(uint(s.Uint64()), mag), true)
+}
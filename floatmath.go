@@ -0,0 +1,576 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// Math library functions, correctly rounded to the format of their operands
+// so that library results can be checked against them bit for bit. Integers
+// and rationals are converted to float64 first.
+
+// FloatUnary sets z to a function of x, rounded to nearest or to odd at z's
+// precision. It panics with big.ErrNaN if the result is NaN.
+type FloatUnary func(z, x *big.Float) *big.Float
+
+// encodedFloat reports whether n is a float with a binary encoding, rather
+// than a rational.
+func encodedFloat(n Num) bool {
+	_, rat := n.val.(*big.Rat)
+	return n.CanFloat() && !rat
+}
+
+// mathOperand returns n as a float or fixed point value, converting integers
+// and rationals to float64.
+func mathOperand(n Num) Num {
+	if encodedFloat(n) || fixedPoint(n) {
+		return n
+	}
+	return Num{n.AsFloat(), n.typed}
+}
+
+// floatOperand returns n as a float with a binary encoding, converting integers
+// and rationals to float64.
+func floatOperand(name string, n Num) Num {
+	n = mathOperand(n)
+	if !encodedFloat(n) {
+		panic(fmt.Errorf("%s needs a float, not %s", name, n.Type()))
+	}
+	return n
+}
+
+// floatUnary applies fn to n with enough precision that rounding the result
+// to the format of n is correctly rounded. NaNs are returned quiet.
+func floatUnary(n Num, fn FloatUnary) (out Num) {
+	n = mathOperand(n)
+	if fixedPoint(n) {
+		return fixedUnary(n, fn)
+	}
+	f := floatFormat(n)
+	if n.IsNaN() {
+		return floatNum(f, f.NaNFrom(f, floatBits(n)), n.typed)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(big.ErrNaN); !ok {
+				panic(r)
+			}
+			out = floatNum(f, f.NaN(), n.typed)
+		}
+	}()
+	// Rounding to odd with two more bits than the format and then to nearest
+	// is correctly rounded.
+	z := new(big.Float).SetPrec(uint(f.Precision() + 2))
+	return floatNum(f, f.Round(fn(z, n.AsBigFloat())), n.typed)
+}
+
+// rootOdd sets z to the k th root of r > 0, for k of 2 or 3, rounded to odd
+// at z's precision.
+func rootOdd(z *big.Float, r *big.Rat, k int) *big.Float {
+	// Scale r by 2**(k s) so that the integer part of its root has a few more
+	// bits than z's precision.
+	bits := r.Num().BitLen() - r.Denom().BitLen()
+	s := (k*(int(z.Prec())+3)-bits)/k + 1
+	num, den := new(big.Int).Set(r.Num()), r.Denom()
+	if s >= 0 {
+		num.Lsh(num, uint(k*s))
+	} else {
+		den = new(big.Int).Lsh(den, uint(-k*s))
+	}
+	n, rem := num.QuoRem(num, den, new(big.Int))
+	root := new(big.Int).Sqrt(n)
+	if k == 3 {
+		root = cbrtBig(n)
+	}
+	// An inexact root gets a set bit below those computed, which rounding to
+	// odd keeps as a record of the lost bits.
+	if rem.Sign() != 0 || new(big.Int).Exp(root, big.NewInt(int64(k)), nil).Cmp(n) != 0 {
+		root.Lsh(root, 1).SetBit(root, 0, 1)
+		s++
+	}
+	v := new(big.Float).SetInt(root)
+	return roundOdd(z, v.SetMantExp(v, -s))
+}
+
+func sqrtFloat(z, x *big.Float) *big.Float {
+	switch {
+	case x.Sign() < 0:
+		panic(big.ErrNaN{})
+	case x.Sign() == 0 || x.IsInf():
+		return z.Set(x)
+	}
+	r, _ := x.Rat(nil)
+	return rootOdd(z, r, 2)
+}
+
+func cbrtFloat(z, x *big.Float) *big.Float {
+	if x.Sign() == 0 || x.IsInf() {
+		return z.Set(x)
+	}
+	r, _ := x.Rat(nil)
+	rootOdd(z, r.Abs(r), 3)
+	if x.Sign() < 0 {
+		z.Neg(z)
+	}
+	return z
+}
+
+func hypotFloat(z, x, y *big.Float) *big.Float {
+	if x.IsInf() || y.IsInf() {
+		return z.SetInf(false)
+	}
+	xr, _ := x.Rat(nil)
+	yr, _ := y.Rat(nil)
+	xr.Mul(xr, xr).Add(xr, yr.Mul(yr, yr))
+	if xr.Sign() == 0 {
+		return z.SetInt64(0)
+	}
+	return rootOdd(z, xr, 2)
+}
+
+// natExpFloat sets z to e**x.
+func natExpFloat(z, x *big.Float) *big.Float {
+	switch {
+	case x.IsInf():
+		if x.Signbit() {
+			return z.SetInt64(0)
+		}
+		return z.SetInf(false)
+	case x.Sign() == 0:
+		return z.SetInt64(1)
+	}
+	xf, _ := x.Float64()
+	switch {
+	case xf > maxPowExp*math.Ln2:
+		return z.SetMantExp(big.NewFloat(1), maxPowExp)
+	case xf < -maxPowExp*math.Ln2:
+		return z.SetMantExp(big.NewFloat(1), -maxPowExp)
+	}
+	return zivRound(z, func(w uint) *big.Float { return bigExp(x, w+4) })
+}
+
+func exp2Float(z, x *big.Float) *big.Float {
+	return powFloat(z, big.NewFloat(2), x)
+}
+
+// logSpecial sets z to the logarithm of x if x is zero, infinite, negative or
+// 1, which are the same for every base, and reports whether it did.
+func logSpecial(z, x *big.Float) bool {
+	switch {
+	case x.Sign() < 0:
+		panic(big.ErrNaN{})
+	case x.Sign() == 0:
+		z.SetInf(true)
+	case x.IsInf():
+		z.SetInf(false)
+	case x.Cmp(big.NewFloat(1)) == 0:
+		z.SetInt64(0)
+	default:
+		return false
+	}
+	return true
+}
+
+func logFloat(z, x *big.Float) *big.Float {
+	if logSpecial(z, x) {
+		return z
+	}
+	return zivRound(z, func(w uint) *big.Float { return bigLog(x, w+4) })
+}
+
+func log2Float(z, x *big.Float) *big.Float {
+	if logSpecial(z, x) {
+		return z
+	}
+	if m, e := oddMant(x); m.Cmp(big1) == 0 {
+		return z.SetInt64(int64(e))
+	}
+	return zivRound(z, func(w uint) *big.Float {
+		t := bigLog(x, w+8)
+		return t.Quo(t, bigLn2(w+8))
+	})
+}
+
+func log10Float(z, x *big.Float) *big.Float {
+	if logSpecial(z, x) {
+		return z
+	}
+	if x.IsInt() {
+		i, _ := x.Int(nil)
+		if s := i.String(); s[0] == '1' && strings.TrimLeft(s[1:], "0") == "" {
+			return z.SetInt64(int64(len(s) - 1))
+		}
+	}
+	return zivRound(z, func(w uint) *big.Float {
+		t := bigLog(x, w+8)
+		return t.Quo(t, bigLog(big.NewFloat(10), w+8))
+	})
+}
+
+func sinFloat(z, x *big.Float) *big.Float {
+	switch {
+	case x.IsInf():
+		panic(big.ErrNaN{})
+	case x.Sign() == 0:
+		return z.Set(x)
+	}
+	return zivRound(z, func(w uint) *big.Float {
+		s, _ := bigSinCos(x, w+4)
+		return s
+	})
+}
+
+func cosFloat(z, x *big.Float) *big.Float {
+	switch {
+	case x.IsInf():
+		panic(big.ErrNaN{})
+	case x.Sign() == 0:
+		return z.SetInt64(1)
+	}
+	return zivRound(z, func(w uint) *big.Float {
+		_, c := bigSinCos(x, w+4)
+		return c
+	})
+}
+
+func tanFloat(z, x *big.Float) *big.Float {
+	switch {
+	case x.IsInf():
+		panic(big.ErrNaN{})
+	case x.Sign() == 0:
+		return z.Set(x)
+	}
+	return zivRound(z, func(w uint) *big.Float {
+		s, c := bigSinCos(x, w+4)
+		return s.Quo(s, c)
+	})
+}
+
+// halfPiFloat sets z to pi/2 with the sign of x.
+func halfPiFloat(z, x *big.Float) *big.Float {
+	return zivRound(z, func(w uint) *big.Float {
+		h := bigHalfPi(w + 4)
+		if x.Signbit() {
+			h.Neg(h)
+		}
+		return h
+	})
+}
+
+func asinFloat(z, x *big.Float) *big.Float {
+	switch c := new(big.Float).Abs(x).Cmp(big.NewFloat(1)); {
+	case c > 0:
+		panic(big.ErrNaN{})
+	case c == 0:
+		return halfPiFloat(z, x)
+	case x.Sign() == 0:
+		return z.Set(x)
+	}
+	return zivRound(z, func(w uint) *big.Float {
+		// asin(x) = atan(x / sqrt((1-x) (1+x))), where the factors are
+		// exact when x is close to ±1.
+		prec := w + 32 + x.Prec()
+		d := new(big.Float).SetPrec(prec).Sub(big.NewFloat(1), x)
+		d.Mul(d, new(big.Float).SetPrec(prec).Add(big.NewFloat(1), x))
+		d.Sqrt(d)
+		return bigAtan(d.Quo(x, d), w+4)
+	})
+}
+
+func acosFloat(z, x *big.Float) *big.Float {
+	switch c := new(big.Float).Abs(x).Cmp(big.NewFloat(1)); {
+	case c > 0:
+		panic(big.ErrNaN{})
+	case c == 0 && x.Sign() > 0:
+		return z.SetInt64(0)
+	case c == 0:
+		return zivRound(z, func(w uint) *big.Float {
+			return new(big.Float).SetPrec(w + 4).Set(bigPi(w + 4))
+		})
+	}
+	return zivRound(z, func(w uint) *big.Float {
+		// acos(x) = 2 atan(sqrt((1-x) / (1+x)))
+		prec := w + 32 + x.Prec()
+		d := new(big.Float).SetPrec(prec).Sub(big.NewFloat(1), x)
+		d.Quo(d, new(big.Float).SetPrec(prec).Add(big.NewFloat(1), x))
+		t := bigAtan(d.Sqrt(d), w+4)
+		return t.SetMantExp(t, 1)
+	})
+}
+
+func atanFloat(z, x *big.Float) *big.Float {
+	switch {
+	case x.IsInf():
+		return halfPiFloat(z, x)
+	case x.Sign() == 0:
+		return z.Set(x)
+	}
+	return zivRound(z, func(w uint) *big.Float { return bigAtan(x, w+4) })
+}
+
+// OpSqrt returns the square root of n.
+func (n Num) OpSqrt() Num { return floatUnary(n, sqrtFloat) }
+
+// OpCbrt returns the cube root of n.
+func (n Num) OpCbrt() Num { return floatUnary(n, cbrtFloat) }
+
+// OpNatExp returns e**n.
+func (n Num) OpNatExp() Num { return floatUnary(n, natExpFloat) }
+
+// OpExp2 returns 2**n.
+func (n Num) OpExp2() Num { return floatUnary(n, exp2Float) }
+
+// OpLog returns the natural logarithm of n.
+func (n Num) OpLog() Num { return floatUnary(n, logFloat) }
+
+// OpLog2 returns the base 2 logarithm of n.
+func (n Num) OpLog2() Num { return floatUnary(n, log2Float) }
+
+// OpLog10 returns the base 10 logarithm of n.
+func (n Num) OpLog10() Num { return floatUnary(n, log10Float) }
+
+// OpSin returns the sine of n radians.
+func (n Num) OpSin() Num { return floatUnary(n, sinFloat) }
+
+// OpCos returns the cosine of n radians.
+func (n Num) OpCos() Num { return floatUnary(n, cosFloat) }
+
+// OpTan returns the tangent of n radians.
+func (n Num) OpTan() Num { return floatUnary(n, tanFloat) }
+
+// OpAsin returns the arcsine of n in radians.
+func (n Num) OpAsin() Num { return floatUnary(n, asinFloat) }
+
+// OpAcos returns the arccosine of n in radians.
+func (n Num) OpAcos() Num { return floatUnary(n, acosFloat) }
+
+// OpAtan returns the arctangent of n in radians.
+func (n Num) OpAtan() Num { return floatUnary(n, atanFloat) }
+
+// OpHypot returns sqrt(n**2 + m**2) without undue overflow or underflow.
+// Like IEEE hypot, it is infinite if either operand is, even if the other is
+// a NaN.
+func (n Num) OpHypot(m Num) Num {
+	n, m = mathOperand(n), mathOperand(m)
+	inf := func(x Num) bool { return !x.IsNaN() && !fixedPoint(x) && x.AsBigFloat().IsInf() }
+	if !fixedPoint(n, m) && (inf(n) || inf(m)) {
+		f, typed := outFloat(n, m)
+		return floatNum(f, f.Inf(0), typed)
+	}
+	return dispatchBinary(n, m, floatOp(hypotFloat), nil, nil, nil, hypotFloat, nil)
+}
+
+// fmaExact returns x*y + w exactly.
+func fmaExact(x, y, w *big.Float) *big.Float {
+	p := new(big.Float).SetPrec(x.Prec()+y.Prec()).Mul(x, y)
+	if p.IsInf() || w.IsInf() || p.Sign() == 0 || w.Sign() == 0 {
+		return new(big.Float).SetPrec(max(p.Prec(), w.Prec())).Add(p, w)
+	}
+	// The sum needs the bits from the top of the larger addend to the bottom
+	// of the smaller.
+	lo := min(p.MantExp(nil)-int(p.Prec()), w.MantExp(nil)-int(w.Prec()))
+	hi := max(p.MantExp(nil), w.MantExp(nil)) + 1
+	return new(big.Float).SetPrec(uint(hi-lo)).Add(p, w)
+}
+
+// OpFma returns n*m + k with a single rounding, in the format arithmetic on
+// the three would give.
+func (n Num) OpFma(m, k Num) (out Num) {
+	nums := []Num{mathOperand(n), mathOperand(m), mathOperand(k)}
+	fma := func() *big.Float {
+		return fmaExact(nums[0].AsBigFloat(), nums[1].AsBigFloat(), nums[2].AsBigFloat())
+	}
+	if fixedPoint(nums...) {
+		q := outFixed(nums...)
+		defer func() {
+			if r := recover(); r != nil {
+				if _, ok := r.(big.ErrNaN); !ok {
+					panic(r)
+				}
+				panic(fmt.Errorf("%s has no NaN", q))
+			}
+		}()
+		for _, num := range nums {
+			if num.IsNaN() {
+				panic(big.ErrNaN{})
+			}
+		}
+		return Num{q.FromBigFloat(fma()), true}
+	}
+	for _, num := range nums {
+		if num.IsNaN() {
+			return propagateNaN(nums...)
+		}
+	}
+	f, typed := outFloat(nums...)
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(big.ErrNaN); !ok {
+				panic(r)
+			}
+			out = floatNum(f, f.NaN(), typed)
+		}
+	}()
+	return floatNum(f, f.Round(fma()), typed)
+}
+
+// signbit reports whether n is negative, or for floats whether their sign bit
+// is set.
+func signbit(n Num) bool {
+	switch v := n.val.(type) {
+	case Fixed:
+		return v.Int().Sign() < 0
+	case *big.Rat:
+		return v.Sign() < 0
+	}
+	if n.CanFloat() {
+		return n.rawBits().Bit(n.Bits()-1) == 1
+	}
+	return n.CanInt() && n.AsBig().Sign() < 0
+}
+
+// OpAbs returns the absolute value of n. Floats have their sign bit cleared,
+// even NaNs.
+func (n Num) OpAbs() Num {
+	if encodedFloat(n) {
+		x := n.rawBits()
+		return n.fromRawBits(x.SetBit(x, n.Bits()-1, 0))
+	}
+	if signbit(n) {
+		return n.OpNeg()
+	}
+	return n
+}
+
+// OpCopysign returns n with the sign of m. Floats have their sign bit set to
+// that of m, even NaNs.
+func (n Num) OpCopysign(m Num) Num {
+	if encodedFloat(n) {
+		var sign uint
+		if signbit(m) {
+			sign = 1
+		}
+		x := n.rawBits()
+		return n.fromRawBits(x.SetBit(x, n.Bits()-1, sign))
+	}
+	n = n.OpAbs()
+	if signbit(m) {
+		return n.OpNeg()
+	}
+	return n
+}
+
+func minOf[N Num64](x, y N) N { return min(x, y) }
+func maxOf[N Num64](x, y N) N { return max(x, y) }
+
+// minMax returns the larger of n and m if greater, and otherwise the smaller,
+// in the type arithmetic on them would give. -0 is smaller than +0. A NaN
+// operand gives NaN, unless number is set, in which case the other operand
+// is returned.
+func minMax(n, m Num, greater, number bool) Num {
+	n, m = ratOperand(n, m), ratOperand(m, n)
+	if number && n.IsNaN() != m.IsNaN() {
+		if n.IsNaN() {
+			n, m = m, n
+		}
+		if fixedPoint(n) {
+			return n
+		}
+		f, typed := outFloat(n, m)
+		return floatNum(f, f.FromNum(n), typed)
+	}
+	// pick reports whether to pick x, which compares with y as c.
+	pick := func(c int) bool { return c == 0 || c > 0 == greater }
+	fnBig := func(x, y *big.Int) *big.Int {
+		if pick(x.Cmp(y)) {
+			return new(big.Int).Set(x)
+		}
+		return new(big.Int).Set(y)
+	}
+	fnFloat := func(z, x, y *big.Float) *big.Float {
+		c := x.Cmp(y)
+		if c == 0 && x.Signbit() != y.Signbit() {
+			c = 1
+			if x.Signbit() {
+				c = -1
+			}
+		}
+		if pick(c) {
+			return z.Set(x)
+		}
+		return z.Set(y)
+	}
+	fnRat := func(z, x, y *big.Rat) *big.Rat {
+		if pick(x.Cmp(y)) {
+			return z.Set(x)
+		}
+		return z.Set(y)
+	}
+	if greater {
+		return dispatchBinary(n, m, maxOf[float64], maxOf[int64], maxOf[uint64], fnBig, fnFloat, fnRat)
+	}
+	return dispatchBinary(n, m, minOf[float64], minOf[int64], minOf[uint64], fnBig, fnFloat, fnRat)
+}
+
+// OpMin returns the smaller of n and m, or NaN if either is NaN, like IEEE
+// minimum.
+func (n Num) OpMin(m Num) Num { return minMax(n, m, false, false) }
+
+// OpMax returns the larger of n and m, or NaN if either is NaN, like IEEE
+// maximum.
+func (n Num) OpMax(m Num) Num { return minMax(n, m, true, false) }
+
+// OpMinNum returns the smaller of n and m, ignoring a NaN, like IEEE
+// minimumNumber and C's fmin.
+func (n Num) OpMinNum(m Num) Num { return minMax(n, m, false, true) }
+
+// OpMaxNum returns the larger of n and m, ignoring a NaN, like IEEE
+// maximumNumber and C's fmax.
+func (n Num) OpMaxNum(m Num) Num { return minMax(n, m, true, true) }
+
+// roundInt returns n rounded to an integer by mode, keeping its type. Zero
+// results keep the sign of n, infinities are unchanged and NaNs are made
+// quiet.
+func (n Num) roundInt(mode quoMode) Num {
+	one := big.NewRat(1, 1)
+	switch v := n.val.(type) {
+	case Fixed:
+		return Num{v.Q.FromRat(new(big.Rat).SetInt(roundQuo(v.Rat(), one, mode))), n.typed}
+	case *big.Rat:
+		return ratNum(new(big.Rat).SetInt(roundQuo(v, one, mode)))
+	}
+	if !n.CanFloat() {
+		return n
+	}
+	f := floatFormat(n)
+	if n.IsNaN() {
+		return floatNum(f, f.NaNFrom(f, floatBits(n)), n.typed)
+	}
+	x := n.AsBigFloat()
+	if x.IsInf() {
+		return n
+	}
+	r, _ := x.Rat(nil)
+	z := new(big.Float).SetInt(roundQuo(r, one, mode))
+	if z.Sign() == 0 {
+		signedZero(z, x.Signbit())
+	}
+	return floatNum(f, f.Round(z), n.typed)
+}
+
+// OpFloor rounds n down to an integer.
+func (n Num) OpFloor() Num { return n.roundInt(quoFloor) }
+
+// OpCeil rounds n up to an integer.
+func (n Num) OpCeil() Num { return n.roundInt(quoCeil) }
+
+// OpTrunc rounds n toward zero to an integer.
+func (n Num) OpTrunc() Num { return n.roundInt(quoTrunc) }
+
+// OpRound rounds n to the nearest integer, with ties away from zero.
+func (n Num) OpRound() Num { return n.roundInt(quoAway) }
+
+// OpRoundEven rounds n to the nearest integer, with ties to even.
+func (n Num) OpRoundEven() Num { return n.roundInt(quoEven) }
@@ -0,0 +1,102 @@
+package main
+
+import "math/big"
+
+// Uint128 is an unsigned 128 bit integer.
+type Uint128 struct {
+	Hi, Lo uint64
+}
+
+// Int128 is a signed, two's complement 128 bit integer.
+type Int128 struct {
+	Hi int64
+	Lo uint64
+}
+
+var (
+	big1      = big.NewInt(1)
+	big2to64  = new(big.Int).Lsh(big1, 64)
+	big2to128 = new(big.Int).Lsh(big1, 128)
+)
+
+// Uint128FromBig returns the low 128 bits of v.
+func Uint128FromBig(v *big.Int) Uint128 {
+	w := new(big.Int).Mod(v, big2to128)
+	lo := new(big.Int).Mod(w, big2to64).Uint64()
+	hi := new(big.Int).Rsh(w, 64).Uint64()
+	return Uint128{hi, lo}
+}
+
+// Int128FromBig returns the low 128 bits of v interpreted as a signed
+// integer.
+func Int128FromBig(v *big.Int) Int128 {
+	return Uint128FromBig(v).Int128()
+}
+
+func (u Uint128) Int128() Int128 {
+	return Int128{int64(u.Hi), u.Lo}
+}
+
+func (i Int128) Uint128() Uint128 {
+	return Uint128{uint64(i.Hi), i.Lo}
+}
+
+func (u Uint128) Big() *big.Int {
+	v := new(big.Int).SetUint64(u.Hi)
+	v.Lsh(v, 64)
+	return v.Or(v, new(big.Int).SetUint64(u.Lo))
+}
+
+func (i Int128) Big() *big.Int {
+	v := i.Uint128().Big()
+	if i.Hi < 0 {
+		v.Sub(v, big2to128)
+	}
+	return v
+}
+
+func (u Uint128) String() string { return u.Big().String() }
+func (i Int128) String() string  { return i.Big().String() }
+
+func (u Uint128) Shl(n uint) Uint128 {
+	switch {
+	case n >= 128:
+		return Uint128{}
+	case n >= 64:
+		return Uint128{u.Lo << (n - 64), 0}
+	default:
+		return Uint128{u.Hi<<n | u.Lo>>(64-n), u.Lo << n}
+	}
+}
+
+func (u Uint128) Shr(n uint) Uint128 {
+	switch {
+	case n >= 128:
+		return Uint128{}
+	case n >= 64:
+		return Uint128{0, u.Hi >> (n - 64)}
+	default:
+		return Uint128{u.Hi >> n, u.Lo>>n | u.Hi<<(64-n)}
+	}
+}
+
+func (i Int128) Shl(n uint) Int128 {
+	return i.Uint128().Shl(n).Int128()
+}
+
+// Shr is an arithmetic right shift.
+func (i Int128) Shr(n uint) Int128 {
+	switch {
+	case n >= 128:
+		return Int128{i.Hi >> 63, uint64(i.Hi >> 63)}
+	case n >= 64:
+		return Int128{i.Hi >> 63, uint64(i.Hi >> (n - 64))}
+	default:
+		return Int128{i.Hi >> n, i.Lo>>n | uint64(i.Hi)<<(64-n)}
+	}
+}
+
+// Trunc clears all but the low n bits.
+func (u Uint128) Trunc(n int) Uint128 {
+	return u.Shl(uint(128 - n)).Shr(uint(128 - n))
+}
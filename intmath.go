@@ -0,0 +1,295 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"slices"
+)
+
+// Number theory on integers. Intermediate results are computed exactly, or
+// with double width products, so only final results can overflow their type.
+
+// intBinary applies fn to the integers n and m, giving a result of the type
+// arithmetic on them would.
+func intBinary(name string, n, m Num, fn BigBinary) Num {
+	requireInts(name, n, m)
+	// Integers never reach the float and rational functions.
+	return dispatchBinary(n, m, nil, intOp(fn), uintOp(fn), fn, nil, nil)
+}
+
+func gcdBig(x, y *big.Int) *big.Int { return new(big.Int).GCD(nil, nil, x, y) }
+
+func lcmBig(x, y *big.Int) *big.Int {
+	if x.Sign() == 0 || y.Sign() == 0 {
+		return new(big.Int)
+	}
+	l := new(big.Int).Quo(x, gcdBig(x, y))
+	return l.Abs(l.Mul(l, y))
+}
+
+// OpGcd returns the greatest common divisor of n and m, which is never
+// negative.
+func (n Num) OpGcd(m Num) Num { return intBinary("gcd", n, m, gcdBig) }
+
+// OpLcm returns the least common multiple of n and m, which is never negative.
+func (n Num) OpLcm(m Num) Num {
+	return overflow(plainMode(), n, "lcm", m, intBinary("lcm", n, m, lcmBig), lcmBig)
+}
+
+// OpIsqrt returns the square root of n rounded down.
+func (n Num) OpIsqrt() Num {
+	requireInts("isqrt", n)
+	x := n.AsBig()
+	if x.Sign() < 0 {
+		panic(errors.New("isqrt of negative value"))
+	}
+	return n.withFieldBits(new(big.Int).Sqrt(x))
+}
+
+// OpIcbrt returns the cube root of n rounded down.
+func (n Num) OpIcbrt() Num {
+	requireInts("icbrt", n)
+	x := n.AsBig()
+	r := cbrtBig(new(big.Int).Abs(x))
+	if x.Sign() < 0 {
+		r.Neg(r)
+		if new(big.Int).Exp(r, big.NewInt(3), nil).Cmp(x) > 0 {
+			r.Sub(r, big1)
+		}
+	}
+	return n.withFieldBits(r)
+}
+
+// cbrtBig returns the cube root of x >= 0 rounded down.
+func cbrtBig(x *big.Int) *big.Int {
+	if x.Sign() == 0 {
+		return new(big.Int)
+	}
+	// Newton's method decreases monotonically to the root from any start
+	// above it.
+	r := new(big.Int).Lsh(big1, uint(x.BitLen()+2)/3)
+	for {
+		// (2r + x/r**2) / 3
+		next := new(big.Int).Mul(r, r)
+		next.Quo(x, next)
+		next.Add(next, new(big.Int).Lsh(r, 1))
+		next.Quo(next, big.NewInt(3))
+		if next.Cmp(r) >= 0 {
+			return r
+		}
+		r = next
+	}
+}
+
+// modulus checks that m is a positive modulus.
+func modulus(name string, m *big.Int) {
+	if m.Sign() <= 0 {
+		panic(fmt.Errorf("%s needs a positive modulus", name))
+	}
+}
+
+// OpModPow returns b**e modulo m, in the range [0, m). Negative exponents
+// raise the inverse of b.
+func (b Num) OpModPow(e, m Num) Num {
+	requireInts("modpow", b, e, m)
+	exp := e.AsBig()
+	return intBinary("modpow", b, m, func(x, y *big.Int) *big.Int {
+		modulus("modpow", y)
+		if exp.Sign() < 0 {
+			x = modInverse(x, y)
+			return new(big.Int).Exp(x, new(big.Int).Neg(exp), y)
+		}
+		return new(big.Int).Exp(new(big.Int).Mod(x, y), exp, y)
+	})
+}
+
+// modInverse returns the inverse of x modulo m > 0, in the range [0, m).
+func modInverse(x, m *big.Int) *big.Int {
+	if m.Cmp(big1) == 0 {
+		return new(big.Int)
+	}
+	inv := new(big.Int).ModInverse(new(big.Int).Mod(x, m), m)
+	if inv == nil {
+		panic(fmt.Errorf("%v has no inverse modulo %v", x, m))
+	}
+	return inv
+}
+
+// OpModInv returns the inverse of n modulo m, in the range [0, m).
+func (n Num) OpModInv(m Num) Num {
+	return intBinary("modinv", n, m, func(x, y *big.Int) *big.Int {
+		modulus("modinv", y)
+		return modInverse(x, y)
+	})
+}
+
+// mulMod returns x * y modulo m without overflow, for x, y < m.
+func mulMod(x, y, m uint64) uint64 {
+	hi, lo := bits.Mul64(x, y)
+	return bits.Rem64(hi, lo, m)
+}
+
+// powMod returns x**e modulo m without overflow, for x < m.
+func powMod(x, e, m uint64) uint64 {
+	acc := uint64(1) % m
+	for ; e > 0; e >>= 1 {
+		if e&1 == 1 {
+			acc = mulMod(acc, x, m)
+		}
+		x = mulMod(x, x, m)
+	}
+	return acc
+}
+
+// millerRabinBases are the first 12 primes, which as Miller-Rabin bases
+// identify every prime below 3.3 * 10**24.
+var millerRabinBases = []uint64{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37}
+
+// isPrime64 reports whether n is prime, with a deterministic Miller-Rabin
+// test.
+func isPrime64(n uint64) bool {
+	for _, p := range millerRabinBases {
+		if n%p == 0 {
+			return n == p
+		}
+	}
+	if n < 2 {
+		return false
+	}
+	// n - 1 = d * 2**s with d odd.
+	s := bits.TrailingZeros64(n - 1)
+	d := (n - 1) >> s
+	for _, a := range millerRabinBases {
+		x := powMod(a, d, n)
+		if x == 1 || x == n-1 {
+			continue
+		}
+		composite := true
+		for i := 1; i < s && composite; i++ {
+			x = mulMod(x, x, n)
+			composite = x != n-1
+		}
+		if composite {
+			return false
+		}
+	}
+	return true
+}
+
+// isPrime reports whether x is prime. Values above 64 bits use a
+// Baillie-PSW test, which no composite is known to pass.
+func isPrime(x *big.Int) bool {
+	if x.Sign() <= 0 {
+		return false
+	}
+	if x.IsUint64() {
+		return isPrime64(x.Uint64())
+	}
+	return x.ProbablyPrime(0)
+}
+
+// OpIsPrime returns 1 if n is prime, otherwise 0.
+func (n Num) OpIsPrime() Num {
+	requireInts("isprime", n)
+	return boolNum(isPrime(n.AsBig()))
+}
+
+// maxRhoSteps bounds the steps Pollard's rho takes to find a factor, which
+// are around the square root of the factor.
+const maxRhoSteps = 1 << 20
+
+// rhoBatch is the number of steps of Pollard's rho between GCDs.
+const rhoBatch = 128
+
+// OpFactor returns the prime factors of n in increasing order, repeated as
+// many times as they divide n.
+func (n Num) OpFactor() []Num {
+	requireInts("factor", n)
+	x := n.AsBig()
+	if x.Sign() <= 0 {
+		panic(errors.New("factor of non-positive value"))
+	}
+	var factors []*big.Int
+	x = new(big.Int).Set(x)
+	// Trial division finds the small factors quickly.
+	for p := int64(2); p < 1000 && x.Cmp(big1) > 0; p++ {
+		bp := big.NewInt(p)
+		for m := new(big.Int); ; {
+			q, _ := new(big.Int).QuoRem(x, bp, m)
+			if m.Sign() != 0 {
+				break
+			}
+			factors = append(factors, bp)
+			x = q
+		}
+	}
+	if x.Cmp(big1) > 0 {
+		factors = append(factors, splitPrimes(x)...)
+	}
+	slices.SortFunc(factors, (*big.Int).Cmp)
+	out := make([]Num, len(factors))
+	for i, f := range factors {
+		out[i] = n.withFieldBits(f)
+	}
+	return out
+}
+
+// splitPrimes returns the prime factors of x > 1, which has no small factors.
+func splitPrimes(x *big.Int) []*big.Int {
+	if isPrime(x) {
+		return []*big.Int{x}
+	}
+	d := pollardRho(x)
+	q := new(big.Int).Quo(x, d)
+	return append(splitPrimes(d), splitPrimes(q)...)
+}
+
+// pollardRho returns a non-trivial factor of the composite x, using Brent's
+// variant of Pollard's rho.
+func pollardRho(x *big.Int) *big.Int {
+	steps := 0
+	diff := new(big.Int)
+	for c := int64(1); ; c++ {
+		// f(y) = y**2 + c modulo x
+		f := func(y *big.Int) {
+			y.Mul(y, y).Add(y, big.NewInt(c))
+			y.Mod(y, x)
+		}
+		y, z, ys := big.NewInt(2), new(big.Int), new(big.Int)
+		d := big.NewInt(1)
+		for r := 1; d.Cmp(big1) == 0; r *= 2 {
+			z.Set(y)
+			for i := 0; i < r; i++ {
+				f(y)
+			}
+			// The differences are multiplied together so that a GCD is
+			// only needed once per batch.
+			for k := 0; k < r && d.Cmp(big1) == 0; k += rhoBatch {
+				if steps += rhoBatch; steps > maxRhoSteps {
+					panic(fmt.Errorf("factor gave up on %v", x))
+				}
+				ys.Set(y)
+				q := big.NewInt(1)
+				for i := 0; i < min(rhoBatch, r-k); i++ {
+					f(y)
+					q.Mul(q, diff.Sub(y, z)).Mod(q, x)
+				}
+				d.GCD(nil, nil, q, x)
+			}
+		}
+		if d.Cmp(x) == 0 {
+			// The batch passed several factors at once, so step through it
+			// again one at a time.
+			for d.SetInt64(1); d.Cmp(big1) == 0; {
+				f(ys)
+				d.GCD(nil, nil, diff.Sub(ys, z), x)
+			}
+		}
+		if d.Cmp(x) != 0 {
+			return d
+		}
+		// The cycle closed without a factor, so try another polynomial.
+	}
+}
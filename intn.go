@@ -0,0 +1,29 @@
+package main
+
+import "strconv"
+
+// IntN is a signed integer with an arbitrary width of 1 to 64 bits. V is
+// always sign extended from N bits.
+type IntN struct {
+	V int64
+	N int
+}
+
+// UintN is an unsigned integer with an arbitrary width of 1 to 64 bits. V
+// never has bits set above the low N bits.
+type UintN struct {
+	V uint64
+	N int
+}
+
+func NewIntN(v int64, n int) IntN {
+	shift := 64 - n
+	return IntN{v << shift >> shift, n}
+}
+
+func NewUintN(v uint64, n int) UintN {
+	return UintN{v & (1<<n - 1), n}
+}
+
+func (i IntN) String() string  { return strconv.FormatInt(i.V, 10) }
+func (u UintN) String() string { return strconv.FormatUint(u.V, 10) }
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+)
+
+// Magic numbers for division by constants, from Hacker's Delight, chapter 10.
+// Division of n by d is replaced by a multiplication giving the high half of
+// the product, an optional addition and shifts.
+
+// maxExhaustiveBits is the widest type for which magic numbers are verified
+// with every dividend. Wider types are verified with a sample of dividends.
+const maxExhaustiveBits = 16
+
+// magicSamples is the number of random dividends magic numbers are verified
+// with for wide types, besides those near the edges.
+const magicSamples = 10000
+
+// OpMagicDiv returns the multiplier, shift and add indicator which replace
+// division by d in the type of d, after verifying them.
+func (d Num) OpMagicDiv() (Num, Num, Num) {
+	if !fixedInt(d) {
+		panic(errors.New("magicdiv needs a divisor of a fixed width type, as in 7 u32 magicdiv"))
+	}
+	w := d.Bits()
+	var m, shift, add *big.Int
+	if d.CanInt() {
+		m, shift, add = magicSigned(d.AsBig(), w)
+	} else {
+		m, shift, add = magicUnsigned(d.AsBig(), w)
+	}
+	verifyMagic(d, m, int(shift.Int64()), add.Int64())
+	return intNum(m, w, d.CanInt(), true), untypedInt(shift), untypedInt(add)
+}
+
+// magicUnsigned returns the magic number for unsigned division by d at width
+// w. If add is 1, the multiplier is 2**w more than m, so the quotient is
+// ((n - t) >> 1 + t) >> (shift - 1) for t the high half of n * m. Otherwise
+// it is the high half of n * m shifted right by shift.
+func magicUnsigned(d *big.Int, w int) (m, shift, add *big.Int) {
+	if d.Cmp(big.NewInt(2)) < 0 {
+		panic(errors.New("magicdiv needs a divisor of at least 2"))
+	}
+	two := new(big.Int).Lsh(big1, uint(w))
+	// nc is the largest dividend which is one less than a multiple of d.
+	nc := new(big.Int).Sub(two, d)
+	nc.Sub(lowMask(w), nc.Mod(nc, d))
+	// Find the smallest p for which 2**p / d rounded up is close enough to
+	// the exact multiplier for every dividend.
+	p := w
+	twoP := new(big.Int)
+	for ; ; p++ {
+		twoP.Lsh(big1, uint(p))
+		r := new(big.Int).Sub(twoP, big1)
+		r.Mod(r, d)
+		lhs := new(big.Int).Sub(d, big1)
+		lhs.Sub(lhs, r)
+		if twoP.Cmp(lhs.Mul(lhs, nc)) > 0 {
+			m = new(big.Int).Add(twoP, lhs.Sub(d, big1))
+			m.Sub(m, r).Quo(m, d)
+			break
+		}
+	}
+	add = new(big.Int)
+	if m.Cmp(two) >= 0 {
+		m.Sub(m, two)
+		add.SetInt64(1)
+	}
+	return m, big.NewInt(int64(p - w)), add
+}
+
+// magicSigned returns the magic number for signed division by d at width w.
+// The quotient is the high half of n * m, plus n if add is 1 or minus n if add
+// is -1, shifted right arithmetically by shift, plus 1 if it is negative.
+func magicSigned(d *big.Int, w int) (m, shift, add *big.Int) {
+	ad := new(big.Int).Abs(d)
+	if ad.Cmp(big.NewInt(2)) < 0 {
+		panic(errors.New("magicdiv needs a divisor other than -1, 0 and 1"))
+	}
+	half := new(big.Int).Lsh(big1, uint(w-1))
+	t := new(big.Int).Set(half)
+	if d.Sign() < 0 {
+		t.Add(t, big1)
+	}
+	// anc is the absolute value of the largest dividend which is one less
+	// than a multiple of d.
+	anc := new(big.Int).Mod(t, ad)
+	anc.Sub(t, anc).Sub(anc, big1)
+	q1, r1 := new(big.Int).QuoRem(half, anc, new(big.Int))
+	q2, r2 := new(big.Int).QuoRem(half, ad, new(big.Int))
+	p := w - 1
+	for {
+		p++
+		// q1 and r1 are 2**p / anc, and q2 and r2 are 2**p / |d|.
+		q1.Lsh(q1, 1)
+		r1.Lsh(r1, 1)
+		if r1.Cmp(anc) >= 0 {
+			q1.Add(q1, big1)
+			r1.Sub(r1, anc)
+		}
+		q2.Lsh(q2, 1)
+		r2.Lsh(r2, 1)
+		if r2.Cmp(ad) >= 0 {
+			q2.Add(q2, big1)
+			r2.Sub(r2, ad)
+		}
+		delta := new(big.Int).Sub(ad, r2)
+		if c := q1.Cmp(delta); c > 0 || c == 0 && r1.Sign() != 0 {
+			break
+		}
+	}
+	m = q2.Add(q2, big1)
+	if d.Sign() < 0 {
+		m.Neg(m)
+	}
+	// The multiplier is used as a signed integer of w bits.
+	m = widthBits(Num{m, false}, w, true)
+	add = new(big.Int)
+	switch {
+	case d.Sign() > 0 && m.Sign() < 0:
+		add.SetInt64(1)
+	case d.Sign() < 0 && m.Sign() > 0:
+		add.SetInt64(-1)
+	}
+	return m, big.NewInt(int64(p - w)), add
+}
+
+// magicQuo returns the quotient of n by the divisor with the magic number m,
+// using the instructions a compiler would, with the arithmetic of w bits.
+func magicQuo(n, m *big.Int, shift int, add int64, w int, signed bool) *big.Int {
+	t := new(big.Int).Mul(n, m)
+	t.Rsh(t, uint(w))
+	if !signed {
+		if add == 0 {
+			return t.Rsh(t, uint(shift))
+		}
+		u := new(big.Int).Sub(n, t)
+		u.Rsh(u, 1).Add(u, t)
+		return u.Rsh(u, uint(shift-1))
+	}
+	switch add {
+	case 1:
+		t.Add(t, n)
+	case -1:
+		t.Sub(t, n)
+	}
+	t = widthBits(Num{t, false}, w, true)
+	t.Rsh(t, uint(shift))
+	if t.Sign() < 0 {
+		t.Add(t, big1)
+	}
+	return t
+}
+
+// verifyMagic checks the magic number for division by d against division,
+// for every dividend of narrow types and a sample of those of wide types.
+func verifyMagic(d Num, m *big.Int, shift int, add int64) {
+	w, signed := d.Bits(), d.CanInt()
+	min, max := intRange(d)
+	check := func(n *big.Int) {
+		want := new(big.Int).Quo(n, d.AsBig())
+		if got := magicQuo(n, m, shift, add, w, signed); got.Cmp(want) != 0 {
+			panic(fmt.Errorf("magicdiv gives %v / %v = %v rather than %v", n, d.AsBig(), got, want))
+		}
+	}
+	if w <= maxExhaustiveBits {
+		for n := new(big.Int).Set(min); n.Cmp(max) <= 0; n.Add(n, big1) {
+			check(n)
+		}
+		return
+	}
+	// The dividends around multiples of d near the edges of the range are
+	// the likeliest to be wrong.
+	ad := new(big.Int).Abs(d.AsBig())
+	for _, edge := range []*big.Int{min, new(big.Int), max} {
+		k := new(big.Int).Quo(edge, ad)
+		k.Mul(k, ad)
+		for _, base := range []*big.Int{edge, k} {
+			for i := int64(-2); i <= 2; i++ {
+				n := new(big.Int).Add(base, big.NewInt(i))
+				if n.Cmp(min) >= 0 && n.Cmp(max) <= 0 {
+					check(n)
+				}
+			}
+		}
+	}
+	rng := rand.New(rand.NewSource(1))
+	span := new(big.Int).Sub(max, min)
+	span.Add(span, big1)
+	for i := 0; i < magicSamples; i++ {
+		n := new(big.Int).Rand(rng, span)
+		check(n.Add(n, min))
+	}
+}
@@ -2,11 +2,14 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"math"
+	"math/big"
 	"os"
 	"regexp"
 	"strconv"
@@ -20,34 +23,211 @@ var reDecNumber = regexp.MustCompile(`(?i)^[+-]?(\d+(\.\d*)?|\.\d+?)(e[+-]?\d+)?
 var reHexNumber = regexp.MustCompile(`(?i)^[+-]?0x[0-9a-f]+(\.[0-9a-f]*)?(p[+-]?\d+)?`)
 var reBinNumber = regexp.MustCompile(`(?i)^[+-]?0b[01]+(\.[01]*)?(p[+-]?\d+)?`)
 var reComment = regexp.MustCompile(`(?m)^(#|//).*?$`)
+var reIntType = regexp.MustCompile(`^([iu])(\d+)\b`)
+var reQType = regexp.MustCompile(`^(u?)q(\d+)(?:\.(\d+))?(raw)?\b`)
+var reFormatDef = regexp.MustCompile(`^fmt[ \t]+([A-Za-z_]\w*)((?:[ \t]+(?:(?:exp|man|bias)=[+-]?\d+|ieee|noinf|finite|explicit)\b)*)`)
+var reExMy = regexp.MustCompile(`^e(\d+)m(\d+)$`)
+var reWord = regexp.MustCompile(`^[A-Za-z_]\w*\b`)
+var reNaN = regexp.MustCompile(`(?i)^([qs])nan[ \t]+(0x[0-9a-f]+|0b[01]+|\d+)[ \t]+([A-Za-z_]\w*)\b`)
+var reMkfloat = regexp.MustCompile(`^mkfloat\b(?:[ \t]+([A-Za-z_]\w*)\b)?`)
 
 type Op int
 
+// IntType converts to an integer of a width without a dedicated Op.
+type IntType struct {
+	Bits   int
+	Signed bool
+}
+
+// QType converts to a fixed point format, or reinterprets bits as one.
+type QType struct {
+	Q   QFormat
+	Raw bool
+}
+
+// FloatType converts to a float format defined with fmt.
+type FloatType struct {
+	F   *FloatFormat
+	Sat bool
+}
+
+// FloatFromBits converts bit input to a float format defined with fmt.
+type FloatFromBits struct {
+	F *FloatFormat
+}
+
+// FormatDef defines a float format with fmt.
+type FormatDef struct {
+	F *FloatFormat
+}
+
+// MakeFloat builds a float of a format from the fields of its encoding.
+type MakeFloat struct {
+	F *FloatFormat
+}
+
 const (
 	OpShl Op = iota
 	OpShr
+	OpLshr
+	OpAshr
 	OpExp
+	OpAddChecked
+	OpSubChecked
+	OpMulChecked
+	OpDivChecked
+	OpExpChecked
+	OpAddSat
+	OpSubSat
+	OpMulSat
+	OpExpSat
+	OpAddCarry
+	OpSubBorrow
+	OpMulExtended
+	OpMulHighUnsigned
+	OpMulHighSigned
+	OpDivWide
+	OpMagicDiv
+	OpGcd
+	OpLcm
+	OpIsqrt
+	OpIcbrt
+	OpModPow
+	OpModInv
+	OpIsPrime
+	OpFactor
+	OpSqrt
+	OpCbrt
+	OpNatExp
+	OpExp2
+	OpLog
+	OpLog2
+	OpLog10
+	OpSin
+	OpCos
+	OpTan
+	OpAsin
+	OpAcos
+	OpAtan
+	OpHypot
+	OpFma
+	OpAbs
+	OpCopysign
+	OpMin
+	OpMax
+	OpMinNum
+	OpMaxNum
+	OpFloor
+	OpCeil
+	OpTrunc
+	OpRound
+	OpRoundEven
+	OpNextUp
+	OpNextDown
+	OpUlp
+	OpUlpDiff
+	OpNeighbors
+	OpFrexp
+	OpLdexp
+	OpSign
+	OpExponent
+	OpMantissa
+	OpSignificand
+	OpFclass
+	OpPayload
 	OpMul
 	OpDiv
+	OpRem
+	OpMod
+	OpEmod
+	OpRemainder
+	OpTdiv
+	OpFdiv
+	OpCdiv
+	OpEdiv
+	OpDivmod
+	OpFdivmod
+	OpEdivmod
 	OpSub
 	OpAdd
 	OpXor
 	OpOr
 	OpAnd
 	OpNot
+	OpPopcnt
+	OpClz
+	OpCtz
+	OpClrsb
+	OpParity
+	OpFfs
+	OpFls
+	OpIlog2
+	OpRotl
+	OpRotr
+	OpBswap
+	OpBswap16
+	OpBswap32
+	OpHswap
+	OpNswap
+	OpBrev
+	OpBrev8
+	OpBset
+	OpBclr
+	OpBtgl
+	OpBtst
+	OpBextr
+	OpBinsert
+	OpSext
+	OpZext
+	OpGenmask
+	OpLomask
+	OpHimask
+	OpAlignUp
+	OpAlignDown
+	OpIsAligned
+	OpIsPow2
+	OpNextPow2
+	OpPrevPow2
+	OpPdep
+	OpPext
+	OpZip
+	OpUnzip
+	OpBperm
 	OpNeg
 	OpI8
 	OpI16
 	OpI32
 	OpI64
+	OpI128
 	OpU8
 	OpU16
 	OpU32
 	OpU64
+	OpU128
 	OpF32
 	OpF64
+	OpF16
+	OpBF16
+	OpF80
+	OpF128
+	OpE4M3
+	OpE4M3Sat
+	OpE5M2
+	OpE5M2Sat
 	OpBits
 	OpFloatFromBits
+	OpF16FromBits
+	OpBF16FromBits
+	OpF80FromBits
+	OpF128FromBits
+	OpE4M3FromBits
+	OpE5M2FromBits
+	OpExact
+	OpInexact
+	OpChecked
+	OpWrapping
+	OpShiftMask
+	OpNoShiftMask
 	OpDump
 	OpPrint
 	OpList
@@ -64,18 +244,138 @@ var tokenMap = []struct {
 	// another, the longer operator should come first (e.g. "**" should
 	// come before "*").
 	{"<<", OpShl},
+	{">>>", OpLshr},
+	{">>a", OpAshr},
 	{">>", OpShr},
+	{"**!", OpExpChecked},
+	{"**|", OpExpSat},
 	{"**", OpExp},
+	{"*!", OpMulChecked},
+	{"*|", OpMulSat},
 	{"*", OpMul},
+	{"/!", OpDivChecked},
 	{"/", OpDiv},
+	{"%", OpRem},
+	{"-!", OpSubChecked},
+	{"-|", OpSubSat},
 	{"-", OpSub},
+	{"+!", OpAddChecked},
+	{"+|", OpAddSat},
 	{"+", OpAdd},
+	{"addc", OpAddCarry},
+	{"subb", OpSubBorrow},
+	{"mulx", OpMulExtended},
+	{"mulw", OpMulExtended},
+	{"mulhu", OpMulHighUnsigned},
+	{"mulhs", OpMulHighSigned},
+	{"divw", OpDivWide},
+	{"magicdiv", OpMagicDiv},
+	{"gcd", OpGcd},
+	{"lcm", OpLcm},
+	{"isqrt", OpIsqrt},
+	{"icbrt", OpIcbrt},
+	{"isprime", OpIsPrime},
+	{"factor", OpFactor},
+	{"frexp", OpFrexp},
+	{"ldexp", OpLdexp},
+	{"significand", OpSignificand},
+	{"sign", OpSign},
+	{"exponent", OpExponent},
+	{"mantissa", OpMantissa},
+	{"fclass", OpFclass}, // Show the class of a float and push its mask
+	{"payload", OpPayload},
+	{"sqrt", OpSqrt},
+	{"cbrt", OpCbrt},
+	{"exp2", OpExp2},
+	{"exp", OpNatExp},
+	{"log2", OpLog2},
+	{"log10", OpLog10},
+	{"log", OpLog},
+	{"sin", OpSin},
+	{"cos", OpCos},
+	{"tan", OpTan},
+	{"asin", OpAsin},
+	{"acos", OpAcos},
+	{"atan", OpAtan},
+	{"hypot", OpHypot},
+	{"fma", OpFma},
+	{"abs", OpAbs},
+	{"copysign", OpCopysign},
+	{"minnum", OpMinNum},
+	{"maxnum", OpMaxNum},
+	{"min", OpMin},
+	{"max", OpMax},
+	{"floor", OpFloor},
+	{"ceil", OpCeil},
+	{"trunc", OpTrunc},
+	{"roundeven", OpRoundEven},
+	{"round", OpRound},
+	{"nextup", OpNextUp},
+	{"nextdown", OpNextDown},
+	{"ulpdiff", OpUlpDiff},
+	{"ulp", OpUlp},
+	{"neighbors", OpNeighbors}, // Show the values either side of the top of the stack
 	{"^", OpXor},
 	{"|", OpOr},
 	{"&", OpAnd},
 	{"~", OpNot},
+	{"modpow", OpModPow},
+	{"modinv", OpModInv},
+	{"mod", OpMod},
+	{"emod", OpEmod},
+	{"remainder", OpRemainder},
+	{"tdiv", OpTdiv},
+	{"fdivmod", OpFdivmod},
+	{"fdiv", OpFdiv},
+	{"cdiv", OpCdiv},
+	{"edivmod", OpEdivmod},
+	{"ediv", OpEdiv},
+	{"divmod", OpDivmod},
+	{"popcnt", OpPopcnt},
+	{"clz", OpClz},
+	{"ctz", OpCtz},
+	{"clrsb", OpClrsb},
+	{"parity", OpParity},
+	{"ffs", OpFfs},
+	{"fls", OpFls},
+	{"ilog2", OpIlog2},
+	{"rotl", OpRotl},
+	{"rotr", OpRotr},
+	{"bswap16", OpBswap16},
+	{"bswap32", OpBswap32},
+	{"bswap", OpBswap},
+	{"hswap", OpHswap},
+	{"nswap", OpNswap},
+	{"brev8", OpBrev8},
+	{"brev", OpBrev},
+	{"bset", OpBset},
+	{"bclr", OpBclr},
+	{"btgl", OpBtgl},
+	{"btst", OpBtst},
+	{"bextr", OpBextr},
+	{"binsert", OpBinsert},
+	{"sext", OpSext},
+	{"zext", OpZext},
+	{"genmask", OpGenmask},
+	{"lomask", OpLomask},
+	{"himask", OpHimask},
+	{"alignup", OpAlignUp},
+	{"aligndown", OpAlignDown},
+	{"isaligned", OpIsAligned},
+	{"ispow2", OpIsPow2},
+	{"nextpow2", OpNextPow2},
+	{"prevpow2", OpPrevPow2},
+	{"pdep", OpPdep},
+	{"pext", OpPext},
+	{"zip", OpZip},
+	{"unzip", OpUnzip},
+	{"bperm", OpBperm},
 	{"neg", OpNeg},
 	{"!", OpNeg},
+	{"i128min", Num{Int128{math.MinInt64, 0}, true}},
+	{"i128max", Num{Int128{math.MaxInt64, math.MaxUint64}, true}},
+	{"u128min", Num{Uint128{0, 0}, true}},
+	{"u128max", Num{Uint128{math.MaxUint64, math.MaxUint64}, true}},
 	{"i64min", Num{int64(math.MinInt64), true}},
 	{"i64max", Num{int64(math.MaxInt64), true}},
 	{"u64min", Num{uint64(0), true}},
@@ -92,6 +392,14 @@ var tokenMap = []struct {
 	{"i8min", Num{int8(math.MinInt8), true}},
 	{"u8min", Num{uint8(0), true}},
 	{"u8max", Num{uint8(math.MaxUint8), true}},
+	{"f128minnorm", Num{Float{Float128, Uint128{0x0001000000000000, 0}}, true}},
+	{"f128minsubnorm", Num{Float{Float128, Uint128{0, 1}}, true}},
+	{"f128min", Num{Float{Float128, Uint128{0xfffeffffffffffff, math.MaxUint64}}, true}},
+	{"f128max", Num{Float{Float128, Uint128{0x7ffeffffffffffff, math.MaxUint64}}, true}},
+	{"f80minnorm", Num{Float{Float80, Uint128{0x0001, 1 << 63}}, true}},
+	{"f80minsubnorm", Num{Float{Float80, Uint128{0, 1}}, true}},
+	{"f80min", Num{Float{Float80, Uint128{0xfffe, math.MaxUint64}}, true}},
+	{"f80max", Num{Float{Float80, Uint128{0x7ffe, math.MaxUint64}}, true}},
 	{"f64minnorm", Num{float64(0x1p-1022), true}},
 	{"f64minsubnorm", Num{float64(math.SmallestNonzeroFloat64), true}},
 	{"f64min", Num{float64(-math.MaxFloat64), true}},
@@ -100,19 +408,57 @@ var tokenMap = []struct {
 	{"f32minsubnorm", Num{float32(math.SmallestNonzeroFloat32), true}},
 	{"f32min", Num{float32(-math.MaxFloat32), true}},
 	{"f32max", Num{float32(math.MaxFloat32), true}},
+	{"f16minnorm", Num{Float{Float16, Uint128{0, 0x0400}}, true}},
+	{"f16minsubnorm", Num{Float{Float16, Uint128{0, 0x0001}}, true}},
+	{"f16min", Num{Float{Float16, Uint128{0, 0xfbff}}, true}},
+	{"f16max", Num{Float{Float16, Uint128{0, 0x7bff}}, true}},
+	{"bf16minnorm", Num{Float{BFloat16, Uint128{0, 0x0080}}, true}},
+	{"bf16minsubnorm", Num{Float{BFloat16, Uint128{0, 0x0001}}, true}},
+	{"bf16min", Num{Float{BFloat16, Uint128{0, 0xff7f}}, true}},
+	{"bf16max", Num{Float{BFloat16, Uint128{0, 0x7f7f}}, true}},
+	{"e4m3minnorm", Num{Float{E4M3, Uint128{0, 0x08}}, true}},
+	{"e4m3minsubnorm", Num{Float{E4M3, Uint128{0, 0x01}}, true}},
+	{"e4m3min", Num{Float{E4M3, Uint128{0, 0xfe}}, true}},
+	{"e4m3max", Num{Float{E4M3, Uint128{0, 0x7e}}, true}},
+	{"e5m2minnorm", Num{Float{E5M2, Uint128{0, 0x04}}, true}},
+	{"e5m2minsubnorm", Num{Float{E5M2, Uint128{0, 0x01}}, true}},
+	{"e5m2min", Num{Float{E5M2, Uint128{0, 0xfb}}, true}},
+	{"e5m2max", Num{Float{E5M2, Uint128{0, 0x7b}}, true}},
 	{"i8", OpI8},
 	{"i16", OpI16},
 	{"i32", OpI32},
 	{"i64", OpI64},
+	{"i128", OpI128},
 	{"u8", OpU8},
 	{"u16", OpU16},
 	{"u32", OpU32},
 	{"u64", OpU64},
+	{"u128", OpU128},
 	{"bits", OpBits},
 	{"fbits", OpFloatFromBits},
 	{"floatfrombits", OpFloatFromBits},
+	{"f16fbits", OpF16FromBits},
+	{"f80fbits", OpF80FromBits},
+	{"f128fbits", OpF128FromBits},
+	{"bf16fbits", OpBF16FromBits},
+	{"e4m3fbits", OpE4M3FromBits},
+	{"e5m2fbits", OpE5M2FromBits},
 	{"f32", OpF32},
 	{"f64", OpF64},
+	{"f16", OpF16},
+	{"f80", OpF80},
+	{"f128", OpF128},
+	{"bf16", OpBF16},
+	{"e4m3sat", OpE4M3Sat},
+	{"e4m3", OpE4M3},
+	{"e5m2sat", OpE5M2Sat},
+	{"e5m2", OpE5M2},
+	{"exact", OpExact},
+	{"inexact", OpInexact},
+	{"checked", OpChecked},
+	{"wrapping", OpWrapping},
+	{"shiftmask", OpShiftMask},
+	{"noshiftmask", OpNoShiftMask},
 	{"drop", OpDrop},
 	{"dup", OpDup},
 	{".", OpDup},
@@ -130,13 +476,40 @@ var tokenMap = []struct {
 func parseDec(s string) (any, error) {
 	float := strings.ContainsAny(s, ".eE")
 	if float {
-		return strconv.ParseFloat(s, 64)
+		// Literals out of float64's range are an error only outside of exact
+		// mode.
+		f, err := strconv.ParseFloat(s, 64)
+		return FloatLit{f, parseRat(s), err}, nil
 	}
+	return parseInt(s, 10)
+}
+
+// parseInt parses an integer literal. Literals too large for 64 bits are
+// parsed as 128 bit integers, and those too large for 128 bits as arbitrary
+// precision integers.
+func parseInt(s string, base int) (any, error) {
+	var val any
+	var err error
 	neg := strings.HasPrefix(s, "-")
 	if neg {
-		return strconv.ParseInt(s, 10, 64)
+		val, err = strconv.ParseInt(s, base, 64)
+	} else {
+		val, err = strconv.ParseUint(s, base, 64)
+	}
+	if !errors.Is(err, strconv.ErrRange) {
+		return val, err
+	}
+	v, ok := new(big.Int).SetString(s, base)
+	switch {
+	case !ok || v.BitLen() > maxUntypedBits:
+		return nil, err
+	case v.Cmp(Int128{math.MinInt64, 0}.Big()) < 0 || v.BitLen() > 128:
+		return v, nil
+	case neg:
+		return Int128FromBig(v), nil
+	default:
+		return Uint128FromBig(v), nil
 	}
-	return strconv.ParseUint(s, 10, 64)
 }
 
 func parseHex(s string) (any, error) {
@@ -144,11 +517,7 @@ func parseHex(s string) (any, error) {
 	float := strings.ContainsAny(s, ".pP")
 
 	if !float {
-		if neg {
-			return strconv.ParseInt(s, 0, 64)
-		} else {
-			return strconv.ParseUint(s, 0, 64)
-		}
+		return parseInt(s, 0)
 	}
 
 	idxWhole := 2
@@ -195,11 +564,7 @@ func parseBin(s string) (any, error) {
 	float := strings.ContainsAny(s, ".pP")
 
 	if !float {
-		if neg {
-			return strconv.ParseInt(s, 0, 64)
-		} else {
-			return strconv.ParseUint(s, 0, 64)
-		}
+		return parseInt(s, 0)
 	}
 
 	idxWhole := 2
@@ -255,13 +620,13 @@ func popToken(script string) (any, string, error) {
 	num := reHexNumber.FindString(script)
 	if num != "" {
 		val, err := parseHex(num)
-		return val, script[len(num):], err
+		return binaryLit(num, val), script[len(num):], err
 	}
 
 	num = reBinNumber.FindString(script)
 	if num != "" {
 		val, err := parseBin(num)
-		return val, script[len(num):], err
+		return binaryLit(num, val), script[len(num):], err
 	}
 
 	num = reDecNumber.FindString(script)
@@ -270,6 +635,59 @@ func popToken(script string) (any, string, error) {
 		return val, script[len(num):], err
 	}
 
+	if m := reQType.FindStringSubmatch(script); m != nil {
+		signed := m[1] == ""
+		intBits, frac := 0, 0
+		if m[3] == "" {
+			// qN is short for q1.N and uqN for uq0.N.
+			frac, _ = strconv.Atoi(m[2])
+			if signed {
+				intBits = 1
+			}
+		} else {
+			intBits, _ = strconv.Atoi(m[2])
+			frac, _ = strconv.Atoi(m[3])
+		}
+		q, err := NewQFormat(intBits, frac, signed)
+		return QType{q, m[4] != ""}, script[len(m[0]):], err
+	}
+
+	if m := reFormatDef.FindStringSubmatch(script); m != nil {
+		f, err := defineFormat(m[1], strings.Fields(m[2]))
+		return FormatDef{f}, script[len(m[0]):], err
+	}
+
+	if m := reNaN.FindStringSubmatch(script); m != nil {
+		val, err := parseNaN(strings.EqualFold(m[1], "s"), m[2], m[3])
+		return val, script[len(m[0]):], err
+	}
+
+	if m := reMkfloat.FindStringSubmatch(script); m != nil {
+		if m[1] == "" {
+			return "", "", errors.New("mkfloat needs a float format")
+		}
+		f, err := floatFormatNamed(m[1])
+		return MakeFloat{f}, script[len(m[0]):], err
+	}
+
+	if word := reWord.FindString(script); word != "" {
+		if tok, ok := formatToken(word); ok {
+			return tok, script[len(word):], nil
+		}
+	}
+
+	if m := reIntType.FindStringSubmatch(script); m != nil {
+		bits, _ := strconv.Atoi(m[2])
+		switch bits {
+		case 8, 16, 32, 64, 128:
+			// Handled by tokenMap
+		default:
+			if bits >= 1 && bits <= 64 {
+				return IntType{bits, m[1] == "i"}, script[len(m[0]):], nil
+			}
+		}
+	}
+
 	for _, e := range tokenMap {
 		if strings.HasPrefix(script, e.s) {
 			return e.v, script[len(e.s):], nil
@@ -283,8 +701,151 @@ func popToken(script string) (any, string, error) {
 	return "", "", fmt.Errorf("syntax error at %q", snippet)
 }
 
+// defineFormat handles "fmt NAME OPTION...", returning the float format it
+// defines. The exponent and mantissa widths default to those given by names
+// like e3m4.
+func defineFormat(name string, opts []string) (*FloatFormat, error) {
+	if _, ok := formats[name]; !ok && reservedName(name) {
+		return nil, fmt.Errorf("format name %q conflicts with existing commands", name)
+	}
+	exp, man := -1, -1
+	if m := reExMy.FindStringSubmatch(name); m != nil {
+		var err error
+		if exp, err = strconv.Atoi(m[1]); err != nil {
+			return nil, fmt.Errorf("format %q: %w", name, err)
+		}
+		if man, err = strconv.Atoi(m[2]); err != nil {
+			return nil, fmt.Errorf("format %q: %w", name, err)
+		}
+	}
+	var bias *int
+	specials := IEEE
+	for _, opt := range opts {
+		key, val, ok := strings.Cut(opt, "=")
+		n, err := strconv.Atoi(val)
+		if ok && err != nil {
+			return nil, fmt.Errorf("format %q option %s: %w", name, key, err)
+		}
+		switch key {
+		case "exp":
+			exp = n
+		case "man":
+			man = n
+		case "bias":
+			bias = &n
+		case "ieee":
+			specials = IEEE
+		case "noinf":
+			specials = FN
+		case "finite":
+			specials = Finite
+		case "explicit":
+			specials = X87
+		}
+	}
+	if exp < 0 || man < 0 {
+		return nil, fmt.Errorf("format %q needs exp= and man= options", name)
+	}
+	return NewFloatFormat(name, exp, man, bias, specials)
+}
+
+// reservedName reports whether name is a command, constant or type name, which
+// a format of the same name would hide or be hidden by.
+func reservedName(name string) bool {
+	switch name {
+	case "fmt", "qnan", "snan", "mkfloat":
+		return true
+	}
+	if reIntType.FindString(name) == name || reQType.FindString(name) == name {
+		return true
+	}
+	for _, e := range tokenMap {
+		if e.s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// formatToken returns the token for a word naming a format defined with fmt,
+// or one of its derived commands and constants.
+func formatToken(word string) (any, bool) {
+	if f, ok := formats[word]; ok {
+		return FloatType{f, false}, true
+	}
+	for _, suffix := range []string{"sat", "fbits", "minnorm", "minsubnorm", "min", "max"} {
+		f, ok := formats[strings.TrimSuffix(word, suffix)]
+		if !ok || !strings.HasSuffix(word, suffix) {
+			continue
+		}
+		switch suffix {
+		case "sat":
+			return FloatType{f, true}, true
+		case "fbits":
+			return FloatFromBits{f}, true
+		case "minnorm":
+			return Num{Float{f, f.MinNormal()}, true}, true
+		case "minsubnorm":
+			return Num{Float{f, Uint128{0, 1}}, true}, true
+		case "min":
+			return Num{Float{f, f.join(1, f.MaxFinite())}, true}, true
+		case "max":
+			return Num{Float{f, f.join(0, f.MaxFinite())}, true}, true
+		}
+	}
+	return nil, false
+}
+
+// floatFormatNames holds the built in float formats by the names of their
+// conversions.
+var floatFormatNames = map[string]*FloatFormat{
+	"f16":  Float16,
+	"bf16": BFloat16,
+	"f32":  Binary32,
+	"f64":  Binary64,
+	"f80":  Float80,
+	"f128": Float128,
+	"e4m3": E4M3,
+	"e5m2": E5M2,
+}
+
+// floatFormatNamed returns the built in format or the format defined with fmt
+// with the given name.
+func floatFormatNamed(name string) (*FloatFormat, error) {
+	f, ok := floatFormatNames[name]
+	if !ok {
+		f, ok = formats[name]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown float format %q", name)
+	}
+	return f, nil
+}
+
+// parseNaN handles "qnan PAYLOAD FORMAT" and "snan PAYLOAD FORMAT", giving the
+// quiet or signaling NaN with the payload in the named format.
+func parseNaN(signaling bool, payload, name string) (Num, error) {
+	f, err := floatFormatNamed(name)
+	if err != nil {
+		return Num{}, err
+	}
+	p, ok := new(big.Int).SetString(payload, 0)
+	if !ok {
+		return Num{}, fmt.Errorf("invalid NaN payload %q", payload)
+	}
+	b, err := f.MakeNaN(p, signaling)
+	return floatNum(f, b, true), err
+}
+
+// tokenize splits script into tokens. Float literals are parsed as exact
+// rationals if exact mode will be enabled when they are executed.
 func tokenize(script string) ([]any, error) {
 	tokens := []any{}
+	exact := exactMode
+	// Formats defined by the script are visible to the rest of it while it is
+	// tokenized, but are only registered when their definitions are run.
+	saved := maps.Clone(formats)
+	defer func() { formats = saved }()
 	for script != "" {
 		var token any
 		var err error
@@ -292,6 +853,21 @@ func tokenize(script string) ([]any, error) {
 		if err != nil {
 			return nil, err
 		}
+		switch token {
+		case OpExact:
+			exact = true
+		case OpInexact:
+			exact = false
+		}
+		if def, ok := token.(FormatDef); ok {
+			formats[def.F.Name] = def.F
+		}
+		if lit, ok := token.(FloatLit); ok {
+			token, err = lit.Value(exact)
+			if err != nil {
+				return nil, err
+			}
+		}
 		if token != "" {
 			tokens = append(tokens, token)
 		}
@@ -333,8 +909,8 @@ func (s *Stack) Print() string {
 	if s.Empty() {
 		return "(empty)"
 	}
-	top := s.Top().val
-	return fmt.Sprintf("%v (%T)", top, top)
+	top := s.Top()
+	return fmt.Sprintf("%v (%s)", top.concise(), top.Type())
 }
 
 func (s *Stack) maxIndexWidth() int {
@@ -352,11 +928,20 @@ func (s *Stack) List() string {
 	var out []string
 	w := s.maxIndexWidth()
 	for i, n := range s.numbers {
-		out = append(out, fmt.Sprintf("%*d: %v (%T)", w, s.Len()-i-1, n.val, n.val))
+		out = append(out, fmt.Sprintf("%*d: %v (%s)", w, s.Len()-i-1, n.concise(), n.Type()))
 	}
 	return strings.Join(out, "\n")
 }
 
+// Neighbors describes the float at the top of the stack and the values either
+// side of it.
+func (s *Stack) Neighbors() string {
+	if s.Empty() {
+		return "(empty)"
+	}
+	return formatNeighbors(s.Top())
+}
+
 func (s *Stack) Dump() string {
 	if s.Empty() {
 		return "(empty)"
@@ -407,10 +992,32 @@ func run(stack *Stack, input func() (string, error)) (skipOutput bool, err error
 			switch v := tok.(type) {
 			case int8, int16, int32, int64,
 				uint8, uint16, uint32, uint64,
-				float32, float64:
+				Int128, Uint128, IntN, UintN, *big.Int, *big.Rat, float32, float64:
 				stack.Push(Num{v, false})
 			case Num:
 				stack.Push(v)
+			case IntType:
+				if v.Signed {
+					stack.Push(stack.Pop().OpInt(v.Bits))
+				} else {
+					stack.Push(stack.Pop().OpUint(v.Bits))
+				}
+			case QType:
+				if v.Raw {
+					stack.Push(stack.Pop().OpFixedRaw(v.Q))
+				} else {
+					stack.Push(stack.Pop().OpFixed(v.Q))
+				}
+			case FloatType:
+				stack.Push(stack.Pop().OpFloat(v.F, v.Sat))
+			case FloatFromBits:
+				stack.Push(stack.Pop().OpFloatBits(v.F))
+			case FormatDef:
+				formats[v.F.Name] = v.F
+			case MakeFloat:
+				man := stack.Pop()
+				exp := stack.Pop()
+				stack.Push(stack.Pop().OpMkfloat(exp, man, v.F))
 			case Op:
 				switch v {
 				// Arithmetic
@@ -430,10 +1037,264 @@ func run(stack *Stack, input func() (string, error)) (skipOutput bool, err error
 					x := stack.Pop()
 					y := stack.Pop()
 					stack.Push(y.OpDiv(x))
+				case OpRem:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpRem(x))
+				case OpMod:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpMod(x))
+				case OpEmod:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpEmod(x))
+				case OpRemainder:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpRemainder(x))
+				case OpTdiv:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpTdiv(x))
+				case OpFdiv:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpFdiv(x))
+				case OpCdiv:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpCdiv(x))
+				case OpEdiv:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpEdiv(x))
+				case OpDivmod:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpTdiv(x))
+					stack.Push(y.OpRem(x))
+				case OpFdivmod:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpFdiv(x))
+					stack.Push(y.OpMod(x))
+				case OpEdivmod:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpEdiv(x))
+					stack.Push(y.OpEmod(x))
 				case OpExp:
 					x := stack.Pop()
 					y := stack.Pop()
 					stack.Push(y.OpExp(x))
+				// Overflow
+				case OpAddChecked:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpAddChecked(x))
+				case OpSubChecked:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpSubChecked(x))
+				case OpMulChecked:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpMulChecked(x))
+				case OpDivChecked:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpDivChecked(x))
+				case OpExpChecked:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpExpChecked(x))
+				case OpAddSat:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpAddSat(x))
+				case OpSubSat:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpSubSat(x))
+				case OpMulSat:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpMulSat(x))
+				case OpExpSat:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpExpSat(x))
+				case OpAddCarry:
+					x := stack.Pop()
+					y := stack.Pop()
+					sum, carry := y.OpAddCarry(x)
+					stack.Push(sum)
+					stack.Push(carry)
+				case OpSubBorrow:
+					x := stack.Pop()
+					y := stack.Pop()
+					diff, borrow := y.OpSubBorrow(x)
+					stack.Push(diff)
+					stack.Push(borrow)
+				case OpMulExtended:
+					x := stack.Pop()
+					y := stack.Pop()
+					lo, hi := y.OpMulExtended(x)
+					stack.Push(lo)
+					stack.Push(hi)
+				case OpMulHighUnsigned:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpMulHighUnsigned(x))
+				case OpMulHighSigned:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpMulHighSigned(x))
+				case OpDivWide:
+					d := stack.Pop()
+					lo := stack.Pop()
+					hi := stack.Pop()
+					q, r := hi.OpDivWide(lo, d)
+					stack.Push(q)
+					stack.Push(r)
+				case OpMagicDiv:
+					m, shift, add := stack.Pop().OpMagicDiv()
+					stack.Push(m)
+					stack.Push(shift)
+					stack.Push(add)
+				// Number theory
+				case OpGcd:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpGcd(x))
+				case OpLcm:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpLcm(x))
+				case OpIsqrt:
+					stack.Push(stack.Pop().OpIsqrt())
+				case OpIcbrt:
+					stack.Push(stack.Pop().OpIcbrt())
+				case OpModPow:
+					m := stack.Pop()
+					e := stack.Pop()
+					stack.Push(stack.Pop().OpModPow(e, m))
+				case OpModInv:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpModInv(x))
+				case OpIsPrime:
+					stack.Push(stack.Pop().OpIsPrime())
+				case OpFactor:
+					for _, f := range stack.Pop().OpFactor() {
+						stack.Push(f)
+					}
+				// Float math
+				case OpSqrt:
+					stack.Push(stack.Pop().OpSqrt())
+				case OpCbrt:
+					stack.Push(stack.Pop().OpCbrt())
+				case OpNatExp:
+					stack.Push(stack.Pop().OpNatExp())
+				case OpExp2:
+					stack.Push(stack.Pop().OpExp2())
+				case OpLog:
+					stack.Push(stack.Pop().OpLog())
+				case OpLog2:
+					stack.Push(stack.Pop().OpLog2())
+				case OpLog10:
+					stack.Push(stack.Pop().OpLog10())
+				case OpSin:
+					stack.Push(stack.Pop().OpSin())
+				case OpCos:
+					stack.Push(stack.Pop().OpCos())
+				case OpTan:
+					stack.Push(stack.Pop().OpTan())
+				case OpAsin:
+					stack.Push(stack.Pop().OpAsin())
+				case OpAcos:
+					stack.Push(stack.Pop().OpAcos())
+				case OpAtan:
+					stack.Push(stack.Pop().OpAtan())
+				case OpHypot:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpHypot(x))
+				case OpFma:
+					k := stack.Pop()
+					m := stack.Pop()
+					stack.Push(stack.Pop().OpFma(m, k))
+				case OpAbs:
+					stack.Push(stack.Pop().OpAbs())
+				case OpCopysign:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpCopysign(x))
+				case OpMin:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpMin(x))
+				case OpMax:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpMax(x))
+				case OpMinNum:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpMinNum(x))
+				case OpMaxNum:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpMaxNum(x))
+				case OpFloor:
+					stack.Push(stack.Pop().OpFloor())
+				case OpCeil:
+					stack.Push(stack.Pop().OpCeil())
+				case OpTrunc:
+					stack.Push(stack.Pop().OpTrunc())
+				case OpRound:
+					stack.Push(stack.Pop().OpRound())
+				case OpRoundEven:
+					stack.Push(stack.Pop().OpRoundEven())
+				// Float neighbors
+				case OpNextUp:
+					stack.Push(stack.Pop().OpNextUp())
+				case OpNextDown:
+					stack.Push(stack.Pop().OpNextDown())
+				case OpUlp:
+					stack.Push(stack.Pop().OpUlp())
+				case OpUlpDiff:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpUlpDiff(x))
+				case OpNeighbors:
+					fmt.Println(stack.Neighbors())
+					printed = true
+				// Float fields
+				case OpFrexp:
+					frac, exp := stack.Pop().OpFrexp()
+					stack.Push(frac)
+					stack.Push(exp)
+				case OpLdexp:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpLdexp(x))
+				case OpSign:
+					stack.Push(stack.Pop().OpSign())
+				case OpExponent:
+					stack.Push(stack.Pop().OpExponent())
+				case OpMantissa:
+					stack.Push(stack.Pop().OpMantissa())
+				case OpSignificand:
+					stack.Push(stack.Pop().OpSignificand())
+				case OpFclass:
+					x := stack.Pop()
+					fmt.Println(formatClass(x))
+					stack.Push(x.OpFclass())
+					printed = true
+				case OpPayload:
+					stack.Push(stack.Pop().OpPayload())
 				case OpShl:
 					x := stack.Pop()
 					y := stack.Pop()
@@ -442,6 +1303,14 @@ func run(stack *Stack, input func() (string, error)) (skipOutput bool, err error
 					x := stack.Pop()
 					y := stack.Pop()
 					stack.Push(y.OpShr(x))
+				case OpLshr:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpLshr(x))
+				case OpAshr:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpAshr(x))
 				case OpNeg:
 					x := stack.Pop()
 					stack.Push(x.OpNeg())
@@ -461,6 +1330,130 @@ func run(stack *Stack, input func() (string, error)) (skipOutput bool, err error
 				case OpNot:
 					x := stack.Pop()
 					stack.Push(x.OpNot())
+				// Bit counting
+				case OpPopcnt:
+					stack.Push(stack.Pop().OpPopcnt())
+				case OpClz:
+					stack.Push(stack.Pop().OpClz())
+				case OpCtz:
+					stack.Push(stack.Pop().OpCtz())
+				case OpClrsb:
+					stack.Push(stack.Pop().OpClrsb())
+				case OpParity:
+					stack.Push(stack.Pop().OpParity())
+				case OpFfs:
+					stack.Push(stack.Pop().OpFfs())
+				case OpFls:
+					stack.Push(stack.Pop().OpFls())
+				case OpIlog2:
+					stack.Push(stack.Pop().OpIlog2())
+				// Rotation and reordering
+				case OpRotl:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpRotl(x))
+				case OpRotr:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpRotr(x))
+				case OpBswap:
+					stack.Push(stack.Pop().OpBswap())
+				case OpBswap16:
+					stack.Push(stack.Pop().OpBswap16())
+				case OpBswap32:
+					stack.Push(stack.Pop().OpBswap32())
+				case OpHswap:
+					stack.Push(stack.Pop().OpHswap())
+				case OpNswap:
+					stack.Push(stack.Pop().OpNswap())
+				case OpBrev:
+					stack.Push(stack.Pop().OpBrev())
+				case OpBrev8:
+					stack.Push(stack.Pop().OpBrev8())
+				// Bits and fields
+				case OpBset:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpBset(x))
+				case OpBclr:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpBclr(x))
+				case OpBtgl:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpBtgl(x))
+				case OpBtst:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpBtst(x))
+				case OpBextr:
+					size := stack.Pop()
+					lo := stack.Pop()
+					stack.Push(stack.Pop().OpBextr(lo, size))
+				case OpBinsert:
+					size := stack.Pop()
+					lo := stack.Pop()
+					field := stack.Pop()
+					stack.Push(stack.Pop().OpBinsert(field, lo, size))
+				case OpSext:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpSext(x))
+				case OpZext:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpZext(x))
+				// Masks and alignment
+				case OpGenmask:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpGenmask(x))
+				case OpLomask:
+					stack.Push(stack.Pop().OpLomask())
+				case OpHimask:
+					stack.Push(stack.Pop().OpHimask())
+				case OpAlignUp:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpAlignUp(x))
+				case OpAlignDown:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpAlignDown(x))
+				case OpIsAligned:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpIsAligned(x))
+				case OpIsPow2:
+					stack.Push(stack.Pop().OpIsPow2())
+				case OpNextPow2:
+					stack.Push(stack.Pop().OpNextPow2())
+				case OpPrevPow2:
+					stack.Push(stack.Pop().OpPrevPow2())
+				// Bit shuffles
+				case OpPdep:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpPdep(x))
+				case OpPext:
+					x := stack.Pop()
+					y := stack.Pop()
+					stack.Push(y.OpPext(x))
+				case OpZip:
+					stack.Push(stack.Pop().OpZip())
+				case OpUnzip:
+					stack.Push(stack.Pop().OpUnzip())
+				case OpBperm:
+					k := stack.Pop().AsInt()
+					if k < 0 || k >= int64(stack.Len()) {
+						panic(fmt.Errorf("bperm needs a value and %d indexes", k))
+					}
+					idx := make([]Num, k)
+					for i := k - 1; i >= 0; i-- {
+						idx[i] = stack.Pop()
+					}
+					stack.Push(stack.Pop().OpBperm(idx))
 				// Conversions
 				case OpI8:
 					stack.Push(stack.Pop().OpI8())
@@ -470,6 +1463,8 @@ func run(stack *Stack, input func() (string, error)) (skipOutput bool, err error
 					stack.Push(stack.Pop().OpI32())
 				case OpI64:
 					stack.Push(stack.Pop().OpI64())
+				case OpI128:
+					stack.Push(stack.Pop().OpI128())
 				case OpU8:
 					stack.Push(stack.Pop().OpU8())
 				case OpU16:
@@ -478,10 +1473,28 @@ func run(stack *Stack, input func() (string, error)) (skipOutput bool, err error
 					stack.Push(stack.Pop().OpU32())
 				case OpU64:
 					stack.Push(stack.Pop().OpU64())
+				case OpU128:
+					stack.Push(stack.Pop().OpU128())
 				case OpF32:
 					stack.Push(stack.Pop().OpF32())
 				case OpF64:
 					stack.Push(stack.Pop().OpF64())
+				case OpF16:
+					stack.Push(stack.Pop().OpF16())
+				case OpBF16:
+					stack.Push(stack.Pop().OpBF16())
+				case OpF80:
+					stack.Push(stack.Pop().OpF80())
+				case OpF128:
+					stack.Push(stack.Pop().OpF128())
+				case OpE4M3:
+					stack.Push(stack.Pop().OpE4M3())
+				case OpE4M3Sat:
+					stack.Push(stack.Pop().OpE4M3Sat())
+				case OpE5M2:
+					stack.Push(stack.Pop().OpE5M2())
+				case OpE5M2Sat:
+					stack.Push(stack.Pop().OpE5M2Sat())
 				// Float to/from bits
 				case OpBits:
 					x := stack.Pop()
@@ -489,6 +1502,39 @@ func run(stack *Stack, input func() (string, error)) (skipOutput bool, err error
 				case OpFloatFromBits:
 					x := stack.Pop()
 					stack.Push(x.OpFloatFromBits())
+				case OpF16FromBits:
+					x := stack.Pop()
+					stack.Push(x.OpF16FromBits())
+				case OpBF16FromBits:
+					x := stack.Pop()
+					stack.Push(x.OpBF16FromBits())
+				case OpF80FromBits:
+					x := stack.Pop()
+					stack.Push(x.OpF80FromBits())
+				case OpF128FromBits:
+					x := stack.Pop()
+					stack.Push(x.OpF128FromBits())
+				case OpE4M3FromBits:
+					x := stack.Pop()
+					stack.Push(x.OpE4M3FromBits())
+				case OpE5M2FromBits:
+					x := stack.Pop()
+					stack.Push(x.OpE5M2FromBits())
+				// Modes
+				case OpExact:
+					exactMode = true
+				case OpInexact:
+					exactMode = false
+				case OpChecked:
+					checkedMode = true
+				case OpWrapping:
+					checkedMode = false
+				case OpShiftMask:
+					mask := stack.Pop()
+					width := stack.Pop()
+					shiftMasks[int(width.AsInt())] = mask.AsInt()
+				case OpNoShiftMask:
+					delete(shiftMasks, int(stack.Pop().AsInt()))
 				// Printing
 				case OpPrint:
 					fmt.Println(stack.Print())
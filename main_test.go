@@ -2,7 +2,9 @@ package main
 
 import (
 	"io"
+	"maps"
 	"math"
+	"math/big"
 	"os"
 	"reflect"
 	"strings"
@@ -15,6 +17,15 @@ func floatEquals(a, b float64) bool {
 	return math.Abs(a-b) < tolerance
 }
 
+// bigInt parses a decimal integer for use in expected stacks.
+func bigInt(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("invalid integer " + s)
+	}
+	return v
+}
+
 func TestRun(t *testing.T) {
 	testCases := []struct {
 		name          string
@@ -29,6 +40,299 @@ func TestRun(t *testing.T) {
 		{"divide", "10 2 /", []any{uint64(5)}, ""},
 		{"exponent", "2 8 **", []any{uint64(256)}, ""},
 
+		// Division and remainders
+		{"rem", "7 3 %", []any{uint64(1)}, ""},
+		{"rem negative", "-7 3 %", []any{int64(-1)}, ""},
+		{"mod", "-7 3 mod", []any{uint64(2)}, ""},
+		{"mod negative divisor", "7 -3 mod", []any{int64(-2)}, ""},
+		{"emod", "-7 -3 emod", []any{uint64(2)}, ""},
+		{"remainder", "7 2 remainder", []any{int64(-1)}, ""},
+		{"remainder tie", "5 2 remainder", []any{uint64(1)}, ""},
+		{"tdiv", "-7 2 tdiv", []any{int64(-3)}, ""},
+		{"fdiv", "-7 2 fdiv", []any{int64(-4)}, ""},
+		{"cdiv", "7 2 cdiv", []any{uint64(4)}, ""},
+		{"ediv", "-7 -2 ediv", []any{uint64(4)}, ""},
+		{"fdiv typed overflow", "-128 i8 -1 fdiv", []any{int8(-128)}, ""},
+		{"mod typed", "-7 i8 3 mod", []any{int8(2)}, ""},
+		{"divmod", "-7 2 divmod", []any{int64(-3), int64(-1)}, ""},
+		{"fdivmod", "-7 2 fdivmod", []any{int64(-4), uint64(1)}, ""},
+		{"edivmod", "-7 -2 edivmod", []any{uint64(4), uint64(1)}, ""},
+		{"rem by zero", "7 0 %", nil, "runtime error: integer divide by zero"},
+		{"fmod", "5.5 2 %", []any{float64(1.5)}, ""},
+		{"fmod exact", "1e300 1e-300 %", []any{math.Mod(1e300, 1e-300)}, ""},
+		{"float mod", "-5.5 2 mod", []any{float64(0.5)}, ""},
+		{"float remainder", "5.5 2 remainder", []any{float64(-0.5)}, ""},
+		{"float fdiv", "-5.5 2 fdiv", []any{float64(-3)}, ""},
+		{"float mod infinite divisor", "-1.0 1.0 0 / mod", []any{math.Inf(1)}, ""},
+		{"float fdiv infinite divisor", "-1.0 1.0 0 / fdiv", []any{float64(-1)}, ""},
+		{"float32 fmod", "7.5 f32 2 %", []any{float32(1.5)}, ""},
+		{"fixed mod", "-7.5 q8.8 2 mod", []any{Fixed{QFormat{8, 8, true}, 0x80, 0}}, ""},
+		{"exact rem", "exact 0.7 0.2 %", []any{big.NewRat(1, 10)}, ""},
+
+		// Overflow
+		{"checked add", "i32max 1 +!", nil, "2147483647 + 1 overflows int32"},
+		{"checked add fits", "i32max -1 +!", []any{int32(math.MaxInt32 - 1)}, ""},
+		{"checked sub unsigned", "0 u8 1 -!", nil, "0 - 1 overflows uint8"},
+		{"checked mul", "16 i8 8 *!", nil, "16 * 8 overflows int8"},
+		{"checked div", "i64min -1 /!", nil, "-9223372036854775808 / -1 overflows int64"},
+		{"checked exp", "2 i32 31 **!", nil, "2 ** 31 overflows int32"},
+		{"checked exp fits", "-2 i32 31 **!", []any{int32(math.MinInt32)}, ""},
+		{"checked exp large", "3 u128 1000 **!", nil, "3 ** 1000 overflows uint128"},
+		{"checked untyped", "0xffffffffffffffff 1 +!", []any{new(big.Int).Lsh(big.NewInt(1), 64)}, ""},
+		{"checked float", "1e308 10 *!", []any{math.Inf(1)}, ""},
+		{"saturating add", "i32max 1 +|", []any{int32(math.MaxInt32)}, ""},
+		{"saturating sub", "i32min 1 -|", []any{int32(math.MinInt32)}, ""},
+		{"saturating sub unsigned", "0 u8 1 -|", []any{uint8(0)}, ""},
+		{"saturating mul", "-100 i8 2 *|", []any{int8(math.MinInt8)}, ""},
+		{"saturating exp", "-3 i8 5 **|", []any{int8(math.MinInt8)}, ""},
+		{"saturating odd width", "100 u7 100 +|", []any{NewUintN(127, 7)}, ""},
+		{"checked mode", "checked i32max 1 +", nil, "2147483647 + 1 overflows int32"},
+		{"checked mode neg", "checked -128 i8 neg", nil, "-128 * -1 overflows int8"},
+		{"checked mode exp", "checked 2 i32 40 **", nil, "2 ** 40 overflows int32"},
+		{"wrapping mode", "checked wrapping i32max 1 +", []any{int32(math.MinInt32)}, ""},
+		{"addc", "0xff u8 1 addc", []any{uint8(0), uint64(1)}, ""},
+		{"addc no carry", "0x7f i8 1 addc", []any{int8(math.MinInt8), uint64(0)}, ""},
+		{"addc signed carry", "-1 i8 1 addc", []any{int8(0), uint64(1)}, ""},
+		{"subb", "0 u8 1 subb", []any{uint8(0xff), uint64(1)}, ""},
+		{"subb no borrow", "5 u8 3 subb", []any{uint8(2), uint64(0)}, ""},
+		{"mulx", "0xff u8 0xff mulx", []any{uint8(1), uint8(0xfe)}, ""},
+		{"mulx signed", "-128 i8 2 mulx", []any{int8(0), int8(-1)}, ""},
+		{"mulx untyped operand", "0xff u8 0x1ff mulx 0xff u8 0x1ff mulhu", []any{uint8(1), uint8(0xfe), uint8(0xfe)}, ""},
+		{"mulx untyped negative", "0xff u8 -1 mulx 0xff u8 -1 mulhs", []any{int8(1), int8(0), int8(0)}, ""},
+		{"mulx 64 bit", "u64max u64 u64max mulx", []any{uint64(1), uint64(math.MaxUint64 - 1)}, ""},
+		{"addc untyped", "1 2 addc", nil, "addc needs integers of a fixed width"},
+
+		// Wide multiply and divide
+		{"mulhu", "u64max u64 u64max mulhu", []any{uint64(math.MaxUint64 - 1)}, ""},
+		{"mulhu signed operands", "-1 i64 -1 mulhu", []any{int64(-2)}, ""},
+		{"mulhs", "-1 i64 -1 mulhs", []any{int64(0)}, ""},
+		{"mulhs unsigned operands", "0xffff u16 2 mulhs", []any{uint16(0xffff)}, ""},
+		{"mulhu 32 bit", "0x80000000 u32 4 mulhu", []any{uint32(2)}, ""},
+		{"mulhu 128 bit", "u128max u128max mulhu", []any{Uint128{math.MaxUint64, math.MaxUint64 - 1}}, ""},
+		{"mulhu untyped", "1 2 mulhu", nil, "mulhu needs integers of a fixed width"},
+		{"mulw", "0xffffffff u32 2 mulw", []any{uint32(0xfffffffe), uint32(1)}, ""},
+		{"divw", "1 u64 0 10 divw", []any{uint64(1844674407370955161), uint64(6)}, ""},
+		{"divw signed", "-1 i64 -10 3 divw", []any{int64(-3), int64(-1)}, ""},
+		{"divw 8 bit", "0x12 u8 0x34 0x56 divw", []any{uint8(0x36), uint8(0x10)}, ""},
+		{"divw overflow", "10 u64 0 10 divw", nil, "divw quotient overflows uint64"},
+		{"divw by zero", "0 u8 1 0 divw", nil, "runtime error: integer divide by zero"},
+
+		// Magic numbers
+		{"magicdiv", "3 u32 magicdiv", []any{uint32(0xaaaaaaab), uint64(1), uint64(0)}, ""},
+		{"magicdiv add", "7 u32 magicdiv", []any{uint32(0x24924925), uint64(3), uint64(1)}, ""},
+		{"magicdiv signed", "7 i32 magicdiv", []any{int32(-0x6db6db6d), uint64(2), uint64(1)}, ""},
+		{"magicdiv signed negative", "-7 i32 magicdiv", []any{int32(0x6db6db6d), uint64(2), int64(-1)}, ""},
+		{"magicdiv 64 bit", "10 u64 magicdiv", []any{uint64(0xcccccccccccccccd), uint64(3), uint64(0)}, ""},
+		{"magicdiv exhaustive", "7 i16 magicdiv", []any{int16(0x4925), uint64(1), uint64(0)}, ""},
+		{"magicdiv odd width", "3 u3 magicdiv", []any{NewUintN(3, 3), uint64(0), uint64(0)}, ""},
+		{"magicdiv one", "1 u32 magicdiv", nil, "magicdiv needs a divisor of at least 2"},
+		{"magicdiv signed one", "-1 i32 magicdiv", nil, "magicdiv needs a divisor other than -1, 0 and 1"},
+		{"magicdiv untyped", "7 magicdiv", nil, "magicdiv needs a divisor of a fixed width type"},
+
+		// Number theory
+		{"gcd", "48 18 gcd", []any{uint64(6)}, ""},
+		{"gcd negative", "-48 18 gcd", []any{uint64(6)}, ""},
+		{"lcm", "4 u8 6 lcm", []any{uint8(12)}, ""},
+		{"lcm zero", "0 6 lcm", []any{uint64(0)}, ""},
+		{"lcm checked", "checked 100 u8 3 lcm", nil, "100 lcm 3 overflows uint8"},
+		{"isqrt", "u64max isqrt", []any{uint64(0xffffffff)}, ""},
+		{"isqrt negative", "-1 isqrt", nil, "isqrt of negative value"},
+		{"icbrt", "26 icbrt", []any{uint64(2)}, ""},
+		{"icbrt negative", "-9 i32 icbrt", []any{int32(-3)}, ""},
+		{"modpow", "4 13 497 modpow", []any{uint64(445)}, ""},
+		{"modpow wide", "3 u64max u64max modpow", []any{uint64(9490648191163651407)}, ""},
+		{"modpow inverse", "3 -1 7 modpow", []any{uint64(5)}, ""},
+		{"modpow zero modulus", "3 2 0 modpow", nil, "modpow needs a positive modulus"},
+		{"modinv", "3 7 modinv", []any{uint64(5)}, ""},
+		{"modinv none", "2 4 modinv", nil, "2 has no inverse modulo 4"},
+		{"isprime", "18446744073709551557 isprime", []any{uint64(1)}, ""},
+		{"isprime strong pseudoprime", "3215031751 isprime", []any{uint64(0)}, ""},
+		{"isprime one", "1 isprime", []any{uint64(0)}, ""},
+		{"factor", "360 u16 factor", []any{uint16(2), uint16(2), uint16(2), uint16(3), uint16(3), uint16(5)}, ""},
+		{"factor large", "4294967291 4294967279 * factor", []any{uint64(4294967279), uint64(4294967291)}, ""},
+		{"factor one", "1 factor", nil, ""},
+		{"factor zero", "0 factor", nil, "factor of non-positive value"},
+		{"exp large exponent", "3 u64max **", []any{uint64(12297829382473034411)}, ""},
+
+		// Float math
+		{"sqrt", "2.0 sqrt bits", []any{uint64(0x3ff6a09e667f3bcd)}, ""},
+		{"sqrt f32", "2 f32 sqrt bits", []any{uint32(0x3fb504f3)}, ""},
+		{"sqrt f16", "2 f16 sqrt bits", []any{uint16(0x3da8)}, ""},
+		{"sqrt negative", "-1.0 sqrt", []any{math.NaN()}, ""},
+		{"sqrt negative zero", "-0.0 sqrt", []any{math.Copysign(0, -1)}, ""},
+		{"sqrt int", "16 sqrt", []any{4.0}, ""},
+		{"sqrt fixed", "2 q8.8 sqrt bits", []any{uint16(0x016a)}, ""},
+		{"cbrt", "-27.0 cbrt", []any{-3.0}, ""},
+		{"cbrt bits", "2.0 cbrt bits", []any{uint64(0x3ff428a2f98d728b)}, ""},
+		{"cbrt f32", "3 f32 cbrt bits", []any{uint32(0x3fb89ba2)}, ""},
+		{"cbrt f16", "3 f16 cbrt bits", []any{uint16(0x3dc5)}, ""},
+		{"exp", "1.0 exp bits", []any{uint64(0x4005bf0a8b145769)}, ""},
+		{"exp f32", "1 f32 exp bits", []any{uint32(0x402df854)}, ""},
+		{"exp f16", "1 f16 exp bits", []any{uint16(0x4170)}, ""},
+		{"exp overflow", "1000.0 exp", []any{math.Inf(1)}, ""},
+		{"exp huge", "1e308 exp", []any{math.Inf(1)}, ""},
+		{"exp tiny", "-1e308 exp", []any{0.0}, ""},
+		{"exp huge f128", "1e300 f128 exp bits", []any{Uint128{0x7fff000000000000, 0}}, ""},
+		{"exp2", "10.0 exp2", []any{1024.0}, ""},
+		{"exp2 bits", "0.5 exp2 bits", []any{uint64(0x3ff6a09e667f3bcd)}, ""},
+		{"exp2 f32", "0.5 f32 exp2 bits", []any{uint32(0x3fb504f3)}, ""},
+		{"exp2 f16", "0.5 f16 exp2 bits", []any{uint16(0x3da8)}, ""},
+		{"exp2 huge", "1e300 exp2", []any{math.Inf(1)}, ""},
+		{"exp2 tiny f80", "-1e300 f80 exp2 bits", []any{Uint128{}}, ""},
+		{"log", "1.0 exp log", []any{1.0}, ""},
+		{"log bits", "10.0 log bits", []any{uint64(0x40026bb1bbb55516)}, ""},
+		{"log f16", "10 f16 log bits", []any{uint16(0x409b)}, ""},
+		{"log2 f32", "3 f32 log2 bits", []any{uint32(0x3fcae00d)}, ""},
+		{"log zero", "0.0 log", []any{math.Inf(-1)}, ""},
+		{"log negative", "-1.0 log", []any{math.NaN()}, ""},
+		{"log2 correctly rounded", "1.2042886974850562 log2 bits", []any{uint64(0x3fd129e1d3d7dd6e)}, ""},
+		{"log10", "1000.0 log10", []any{3.0}, ""},
+		{"log10 bits", "2.0 log10 bits", []any{uint64(0x3fd34413509f79ff)}, ""},
+		{"log10 f16", "2 f16 log10 bits", []any{uint16(0x34d1)}, ""},
+		{"sin large argument", "1e22 sin bits", []any{uint64(0xbfeb453ab76bf397)}, ""},
+		{"sin f64max", "f64max sin bits", []any{uint64(0x3f7452fc98b34e97)}, ""},
+		{"sin", "1.0 sin bits", []any{uint64(0x3feaed548f090cee)}, ""},
+		{"sin f32", "1 f32 sin bits", []any{uint32(0x3f576aa4)}, ""},
+		{"sin infinite", "1.0 0.0 / sin", []any{math.NaN()}, ""},
+		{"cos", "0.0 cos", []any{1.0}, ""},
+		{"cos f16", "1 f16 cos bits", []any{uint16(0x3853)}, ""},
+		{"tan", "1.0 tan bits", []any{uint64(0x3ff8eb245cbee3a6)}, ""},
+		{"tan f32", "1 f32 tan bits", []any{uint32(0x3fc75923)}, ""},
+		{"asin", "1.0 asin bits", []any{uint64(0x3ff921fb54442d18)}, ""},
+		{"asin half", "0.5 asin bits", []any{uint64(0x3fe0c152382d7366)}, ""},
+		{"asin out of range", "2.0 asin", []any{math.NaN()}, ""},
+		{"acos", "-1.0 acos bits", []any{uint64(0x400921fb54442d18)}, ""},
+		{"acos near -1", "-0.9999999999136172 acos bits", []any{uint64(0x400921f4701aac22)}, ""},
+		{"acos f16", "0.5 f16 acos bits", []any{uint16(0x3c30)}, ""},
+		{"atan", "1.0 atan bits", []any{uint64(0x3fe921fb54442d18)}, ""},
+		{"atan f32", "0.5 f32 atan bits", []any{uint32(0x3eed6338)}, ""},
+		{"atan infinite", "-1.0 0.0 / atan bits", []any{uint64(0xbff921fb54442d18)}, ""},
+		{"hypot", "3.0 4.0 hypot", []any{5.0}, ""},
+		{"hypot f32", "3 f32 4 hypot", []any{float32(5)}, ""},
+		{"hypot f16", "1 f16 1 hypot bits", []any{uint16(0x3da8)}, ""},
+		{"hypot infinite nan", "0.0 0.0 / 1.0 0.0 / hypot", []any{math.Inf(1)}, ""},
+		{"fma", "0.1 10.0 -1.0 fma", []any{0x1p-54}, ""},
+		{"fma f32", "0.1 f32 10 -1 fma", []any{float32(0x1p-26)}, ""},
+		{"fma f16", "0.1 f16 10 -1 fma bits", []any{uint16(0x8c00)}, ""},
+		{"fma nan", "0.0 1.0 0.0 / 1.0 fma", []any{math.NaN()}, ""},
+		{"abs", "-2.5 abs", []any{2.5}, ""},
+		{"abs int", "-5 i8 abs", []any{int8(5)}, ""},
+		{"abs nan", "0.0 0.0 / neg abs bits", []any{uint64(0x7ff8000000000000)}, ""},
+		{"copysign", "3.0 -0.0 copysign", []any{-3.0}, ""},
+		{"copysign int", "3 i32 -2.0 copysign", []any{int32(-3)}, ""},
+		{"min zero", "0.0 -0.0 min", []any{math.Copysign(0, -1)}, ""},
+		{"max zero", "-0.0 0.0 max", []any{0.0}, ""},
+		{"min nan", "0.0 0.0 / 1.0 min", []any{math.NaN()}, ""},
+		{"minnum nan", "0.0 0.0 / 1.0 minnum", []any{1.0}, ""},
+		{"maxnum nan f32", "0.0 0.0 / f32 2 maxnum", []any{float32(2)}, ""},
+		{"max int", "3 i8 -4 max", []any{int8(3)}, ""},
+		{"floor", "-2.5 floor", []any{-3.0}, ""},
+		{"ceil negative zero", "-0.5 ceil", []any{math.Copysign(0, -1)}, ""},
+		{"trunc", "-2.7 f32 trunc", []any{float32(-2)}, ""},
+		{"round", "2.5 round", []any{3.0}, ""},
+		{"roundeven", "2.5 roundeven", []any{2.0}, ""},
+		{"round fixed", "1.5 q8.8 round bits", []any{uint16(0x0200)}, ""},
+
+		// Float neighbors
+		{"nextup", "1.0 nextup bits", []any{uint64(0x3ff0000000000001)}, ""},
+		{"nextup f32", "1.0 f32 nextup", []any{float32(1.0000001)}, ""},
+		{"nextup negative zero", "-0.0 nextup bits", []any{uint64(1)}, ""},
+		{"nextup negative", "-5e-324 nextup bits", []any{uint64(0x8000000000000000)}, ""},
+		{"nextup max", "f32max nextup", []any{float32(math.Inf(1))}, ""},
+		{"nextup -inf", "1.0 0.0 / neg nextup", []any{-math.MaxFloat64}, ""},
+		{"nextup nan", "0.0 0.0 / nextup", []any{math.NaN()}, ""},
+		{"nextup int", "1 nextup bits", []any{uint64(0x3ff0000000000001)}, ""},
+		{"nextup f16", "1 f16 nextup bits", []any{uint16(0x3c01)}, ""},
+		{"nextup e4m3 max", "e4m3max nextup bits", []any{uint8(0x7e)}, ""},
+		{"nextdown e4m3 min", "e4m3min nextdown bits", []any{uint8(0xfe)}, ""},
+		{"nextup finite max", "fmt e2m1 finite e2m1max nextup f64", []any{6.0}, ""},
+		{"nextup fixed", "1 q8.8 nextup", nil, "nextup needs a float"},
+		{"nextdown", "1.0 nextdown bits", []any{uint64(0x3fefffffffffffff)}, ""},
+		{"nextdown zero", "0.0 nextdown bits", []any{uint64(0x8000000000000001)}, ""},
+		{"nextdown f32", "0.0 f32 nextdown", []any{-float32(math.SmallestNonzeroFloat32)}, ""},
+		{"nextdown inf", "1.0 0.0 / nextdown", []any{math.MaxFloat64}, ""},
+		{"nextdown f80", "1 f80 nextdown bits", []any{Uint128{0x3ffe, 0xffffffffffffffff}}, ""},
+		{"ulp", "1.0 ulp", []any{0x1p-52}, ""},
+		{"ulp f32", "1.0 f32 ulp", []any{float32(0x1p-23)}, ""},
+		{"ulp binade", "0.75 f32 ulp", []any{float32(0x1p-24)}, ""},
+		{"ulp zero", "-0.0 ulp", []any{5e-324}, ""},
+		{"ulp max", "f64max ulp", []any{0x1p971}, ""},
+		{"ulp inf", "1.0 0.0 / neg ulp", []any{math.Inf(1)}, ""},
+		{"ulpdiff", "1.0 nextup nextup 1.0 ulpdiff", []any{uint64(2)}, ""},
+		{"ulpdiff negative", "1.0 f32 1.0000001 ulpdiff", []any{int64(-1)}, ""},
+		{"ulpdiff across zero", "5e-324 -5e-324 ulpdiff", []any{uint64(2)}, ""},
+		{"ulpdiff zeros", "0.0 -0.0 ulpdiff", []any{uint64(0)}, ""},
+		{"ulpdiff f32", "1.0 f32 2.0 f32 ulpdiff", []any{int64(-0x800000)}, ""},
+		{"ulpdiff formats", "1.0 f32 2.0 f64 ulpdiff", nil, "ulpdiff needs floats of the same format, not float32 and float64"},
+		{"ulpdiff nan", "0.0 0.0 / 1.0 ulpdiff", nil, "ulpdiff of NaN"},
+		{"neighbors", "0.1 f32 neighbors", []any{float32(0.1)}, ""},
+		{"neighbors nan", "0.0 0.0 / neighbors", nil, "neighbors of NaN"},
+
+		// Float fields
+		{"frexp", "12.0 frexp", []any{0.75, uint64(4)}, ""},
+		{"frexp f32 negative", "-0.375 f32 frexp", []any{float32(-0.75), int64(-1)}, ""},
+		{"frexp subnormal", "5e-324 frexp", []any{0.5, int64(-1073)}, ""},
+		{"frexp zero", "-0.0 frexp", []any{math.Copysign(0, -1), uint64(0)}, ""},
+		{"frexp inf", "1.0 0.0 / frexp", []any{math.Inf(1), uint64(0)}, ""},
+		{"frexp f16", "6 f16 frexp x bits", []any{uint64(3), uint16(0x3a00)}, ""},
+		{"ldexp", "0.75 4 ldexp", []any{12.0}, ""},
+		{"ldexp f32 overflow", "1.0 f32 128 ldexp", []any{float32(math.Inf(1))}, ""},
+		{"ldexp subnormal", "1.0 -1074 ldexp bits", []any{uint64(1)}, ""},
+		{"ldexp huge", "1.0 f16 -1 i128 100 << ldexp bits", []any{uint16(0)}, ""},
+		{"ldexp float exponent", "1.0 2.0 ldexp", nil, "ldexp needs integers, not float64"},
+		{"sign", "-2.0 sign", []any{uint64(1)}, ""},
+		{"sign zero", "0.0 f32 sign", []any{uint64(0)}, ""},
+		{"exponent", "1.0 f32 exponent", []any{uint64(127)}, ""},
+		{"exponent subnormal", "5e-324 exponent", []any{uint64(0)}, ""},
+		{"exponent inf", "1.0 0.0 / exponent", []any{uint64(0x7ff)}, ""},
+		{"mantissa", "1.5 f32 mantissa", []any{uint64(0x400000)}, ""},
+		{"mantissa f80", "1.5 f80 mantissa", []any{uint64(0x4000000000000000)}, ""},
+		{"mantissa f128", "1.0 f128 nextup mantissa", []any{uint64(1)}, ""},
+		{"mantissa fixed", "1 q8.8 mantissa", nil, "mantissa needs a float, not q8.8"},
+		{"significand", "12.0 significand", []any{1.5}, ""},
+		{"significand subnormal", "3 f16 -24 ldexp significand bits", []any{uint16(0x3e00)}, ""},
+		{"significand zero", "-0.0 f32 significand", []any{float32(math.Copysign(0, -1))}, ""},
+		{"mkfloat", "0 127 0x400000 mkfloat f32", []any{float32(1.5)}, ""},
+		{"mkfloat negative", "1 0x3ff 0 mkfloat f64", []any{-1.0}, ""},
+		{"mkfloat f80", "0 0x3fff 0 mkfloat f80 bits", []any{Uint128{0x3fff, 0x8000000000000000}}, ""},
+		{"mkfloat subnormal", "0 0 1 mkfloat f16 bits", []any{uint16(1)}, ""},
+		{"mkfloat nan", "0 255 1 mkfloat f32 bits", []any{uint32(0x7f800001)}, ""},
+		{"mkfloat exponent range", "0 256 0 mkfloat f32", nil, "mkfloat exponent field 256 out of range of float32"},
+		{"mkfloat sign range", "2 0 0 mkfloat f64", nil, "mkfloat sign field 2 out of range of float64"},
+		{"mkfloat custom format", "fmt e3m4 bias=3 noinf 0 3 8 mkfloat e3m4 f64", []any{1.5}, ""},
+		{"mkfloat unknown format", "0 0 0 mkfloat bits", nil, `unknown float format "bits"`},
+		{"mkfloat no format", "0 0 0 mkfloat", nil, "mkfloat needs a float format"},
+		{"mkfloat float field", "0 1.0 0 mkfloat f64", nil, "mkfloat needs integers, not float64"},
+		{"fclass", "-1.0 fclass", []any{uint16(1 << 1)}, ""},
+
+		// NaN payloads
+		{"snan", "snan 0x123 f32 bits", []any{uint32(0x7f800123)}, ""},
+		{"qnan", "qnan 0x123 f32 bits", []any{uint32(0x7fc00123)}, ""},
+		{"qnan f80", "qnan 5 f80 bits", []any{Uint128{0x7fff, 0xc000000000000005}}, ""},
+		{"qnan e4m3", "qnan 0 e4m3 bits", []any{uint8(0x7f)}, ""},
+		{"snan custom format", "fmt e5m4 snan 3 e5m4 payload", []any{uint64(3)}, ""},
+		{"snan zero payload", "snan 0 f32", nil, "signaling NaN needs a non-zero payload"},
+		{"qnan payload range", "qnan 0x400000 f32", nil, "NaN payload 4194304 out of range of float32"},
+		{"snan e4m3", "snan 1 e4m3", nil, "e4m3 has no signaling NaN"},
+		{"qnan e4m3 payload", "qnan 1 e4m3", nil, "e4m3 NaN has no payload"},
+		{"qnan unknown format", "qnan 1 nope", nil, `unknown float format "nope"`},
+		{"payload", "snan 0x123 f32 payload", []any{uint64(0x123)}, ""},
+		{"payload non-nan", "1.0 payload", nil, "payload needs a NaN, not 1"},
+		{"nan widen", "snan 0x123 f32 f64 bits", []any{uint64(0x7ff8002460000000)}, ""},
+		{"nan widen f80", "snan 5 f64 f80 payload", []any{uint64(0x2800)}, ""},
+		{"nan narrow", "snan 0x123456 f64 f32 bits", []any{uint32(0x7fc00000)}, ""},
+		{"nan narrow top bits", "qnan 0x3fffff f32 f16 bits", []any{uint16(0x7fff)}, ""},
+		{"nan narrow sign", "qnan 1 f64 neg f32 bits", []any{uint32(0xffc00000)}, ""},
+		{"nan e4m3 sign", "qnan 5 f32 neg e4m3 bits", []any{uint8(0xff)}, ""},
+		{"nan add", "qnan 7 f16 1.0 + payload", []any{uint64(7)}, ""},
+		{"nan mul formats", "1.0 f32 qnan 7 f64 * payload", []any{uint64(7)}, ""},
+		{"nan first operand", "snan 1 f64 qnan 2 f64 + bits", []any{uint64(0x7ff8000000000001)}, ""},
+		{"nan first operand sub", "qnan 2 f64 snan 1 f64 - payload", []any{uint64(2)}, ""},
+		{"nan default", "0.0 0.0 / bits", []any{uint64(0x7ff8000000000000)}, ""},
+		{"nan sqrt quiets", "snan 3 f64 sqrt bits", []any{uint64(0x7ff8000000000003)}, ""},
+		{"nan floor quiets", "snan 9 f16 floor bits", []any{uint16(0x7e09)}, ""},
+		{"nan neg", "snan 3 f32 neg bits", []any{uint32(0xff800003)}, ""},
+
 		// Number Bases
 		{"hex add", "0x10 0x20 +", []any{uint64(0x30)}, ""},
 		{"bin add", "0b10 0b11 +", []any{uint64(5)}, ""},
@@ -56,8 +360,129 @@ func TestRun(t *testing.T) {
 		{"or", "0x0f 0xf0 |", []any{uint64(0xff)}, ""},
 		{"xor", "0x55 0xff ^", []any{uint64(0xaa)}, ""},
 		{"not", "0xffffffffffffffff ~", []any{uint64(0)}, ""},
+
+		// Bit counting
+		{"popcnt", "0x1234 u16 popcnt", []any{uint64(5)}, ""},
+		{"popcnt negative", "-1 i8 popcnt", []any{uint64(8)}, ""},
+		{"clz width", "0x1234 u16 clz", []any{uint64(3)}, ""},
+		{"clz zero", "0 u16 clz", []any{uint64(16)}, ""},
+		{"clz untyped", "1 clz", []any{uint64(63)}, ""},
+		{"clz arbitrary width", "1 u5 clz", []any{uint64(4)}, ""},
+		{"ctz", "0x10 u8 ctz", []any{uint64(4)}, ""},
+		{"ctz zero", "0 u32 ctz", []any{uint64(32)}, ""},
+		{"clrsb negative", "-2 i16 clrsb", []any{uint64(14)}, ""},
+		{"clrsb positive", "1 i8 clrsb", []any{uint64(6)}, ""},
+		{"parity", "7 u8 parity", []any{uint64(1)}, ""},
+		{"ffs", "0x18 ffs", []any{uint64(4)}, ""},
+		{"ffs zero", "0 ffs", []any{uint64(0)}, ""},
+		{"fls", "0x18 fls", []any{uint64(5)}, ""},
+		{"ilog2", "1000 ilog2", []any{uint64(9)}, ""},
+		{"ilog2 zero", "0 ilog2", nil, "ilog2 of zero"},
+		{"ilog2 negative", "-4 i8 ilog2", nil, "ilog2 of negative value"},
+		{"popcnt float bits", "1.0 f32 popcnt", []any{uint64(7)}, ""},
+
+		// Rotation and reordering
+		{"rotl", "0x81 u8 1 rotl", []any{uint8(0x03)}, ""},
+		{"rotr", "0x81 u8 1 rotr", []any{uint8(0xc0)}, ""},
+		{"rotl negative", "0x81 u8 -1 rotl", []any{uint8(0xc0)}, ""},
+		{"rotl wide count", "0x81 u8 9 rotl", []any{uint8(0x03)}, ""},
+		{"rotr untyped", "1 1 rotr", []any{uint64(1 << 63)}, ""},
+		{"rotl signed", "-0x8000 i16 1 rotl", []any{int16(1)}, ""},
+		{"bswap", "0x1234 u16 bswap", []any{uint16(0x3412)}, ""},
+		{"bswap signed", "0x1280 i16 bswap", []any{int16(-0x7fee)}, ""},
+		{"bswap16", "0x12345678 u32 bswap16", []any{uint32(0x34127856)}, ""},
+		{"bswap32", "0x0123456789abcdef u64 bswap32", []any{uint64(0x67452301efcdab89)}, ""},
+		{"hswap", "0x12345678 u32 hswap", []any{uint32(0x56781234)}, ""},
+		{"nswap", "0x1234 u16 nswap", []any{uint16(0x2143)}, ""},
+		{"brev", "1 u8 brev", []any{uint8(0x80)}, ""},
+		{"brev8", "0x0102 u16 brev8", []any{uint16(0x8040)}, ""},
+		{"bswap float bits", "1.0 f32 bswap", []any{math.Float32frombits(0x0000803f)}, ""},
+		{"bswap odd width", "1 u12 bswap", nil, "bswap needs a width which is a multiple of 8 bits, not 12"},
+
+		// Bits and fields
+		{"bset", "0 u8 3 bset", []any{uint8(8)}, ""},
+		{"bclr", "0xff u8 3 bclr", []any{uint8(0xf7)}, ""},
+		{"btgl", "5 u8 0 btgl", []any{uint8(4)}, ""},
+		{"btst", "4 u8 2 btst", []any{uint64(1)}, ""},
+		{"btst clear", "4 u8 1 btst", []any{uint64(0)}, ""},
+		{"bset out of range", "1 u8 8 bset", nil, "bit 8 out of range for 8 bit value"},
+		{"bset huge bit", "1 u8 9223372036854775807 bset", nil, "bit 9223372036854775807 out of range for 8 bit value"},
+		{"bclr huge bit", "1 u8 9223372036854775807 bclr", nil, "bit 9223372036854775807 out of range for 8 bit value"},
+		{"bextr huge size", "1 u8 1 9223372036854775807 bextr", nil, "bits 1 to 9223372036854775807 out of range for 8 bit value"},
+		{"bextr huge bit", "1 u8 9223372036854775807 2 bextr", nil, "bits 9223372036854775807 to 9223372036854775808 out of range for 8 bit value"},
+		{"binsert huge bit", "1 u8 1 9223372036854775807 1 binsert", nil, "bit 9223372036854775807 out of range for 8 bit value"},
+		{"binsert huge size", "1 u8 1 1 9223372036854775807 binsert", nil, "bits 1 to 9223372036854775807 out of range for 8 bit value"},
+		{"bset untyped wide", "0 64 bset", []any{new(big.Int).Lsh(big.NewInt(1), 64)}, ""},
+		{"bclr untyped negative", "-1 0 bclr", []any{int64(-2)}, ""},
+		{"bextr", "0x12345678 u32 8 8 bextr", []any{uint32(0x56)}, ""},
+		{"bextr float", "1.0 f32 23 8 bextr", []any{uint64(127)}, ""},
+		{"bextr out of range", "0 u8 4 6 bextr", nil, "bits 4 to 9 out of range for 8 bit value"},
+		{"binsert", "0x12345678 u32 0xab 8 8 binsert", []any{uint32(0x1234ab78)}, ""},
+		{"binsert negative field", "0 u8 -1 4 4 binsert", []any{uint8(0xf0)}, ""},
+		{"binsert field too wide", "0 u8 16 4 4 binsert", nil, "field 16 does not fit in 4 bits"},
+		{"binsert float", "1.0 f32 0x80 23 8 binsert", []any{float32(2)}, ""},
+		{"sext", "0x80 7 sext", []any{int64(-128)}, ""},
+		{"sext typed", "0x0fff u16 11 sext", []any{uint16(0xffff)}, ""},
+		{"sext positive", "0x0f7f u16 7 sext", []any{uint16(0x7f)}, ""},
+		{"zext", "-1 i8 3 zext", []any{int8(15)}, ""},
+
+		// Masks and alignment
+		{"genmask", "31 8 genmask u32", []any{uint32(0xffffff00)}, ""},
+		{"genmask typed", "7 u8 4 genmask", []any{uint8(0xf0)}, ""},
+		{"genmask out of range", "32 u32 0 genmask", nil, "genmask needs 0 <= lo <= hi < 32"},
+		{"genmask reversed", "4 8 genmask", nil, "genmask needs 0 <= lo <= hi < 65536"},
+		{"lomask", "12 u16 lomask", []any{uint16(0xfff)}, ""},
+		{"lomask full", "64 lomask", []any{uint64(math.MaxUint64)}, ""},
+		{"himask", "4 u16 himask", []any{uint16(0xf000)}, ""},
+		{"himask untyped", "8 himask", []any{uint64(0xff00000000000000)}, ""},
+		{"alignup", "0x1001 0x1000 alignup", []any{uint64(0x2000)}, ""},
+		{"alignup aligned", "0x1000 0x1000 alignup", []any{uint64(0x1000)}, ""},
+		{"alignup wraps", "0xf1 u8 16 alignup", []any{uint8(0)}, ""},
+		{"alignup non power of 2", "10 3 alignup", []any{uint64(12)}, ""},
+		{"aligndown", "0x1fff u16 0x1000 aligndown", []any{uint16(0x1000)}, ""},
+		{"aligndown negative", "-5 4 aligndown", []any{int64(-8)}, ""},
+		{"alignup zero alignment", "4 0 alignup", nil, "alignup needs a positive alignment"},
+		{"alignup float", "1.5 4 alignup", nil, "alignup needs integers, not float64"},
+		{"isaligned", "0x3000 0x1000 isaligned", []any{uint64(1)}, ""},
+		{"isaligned not", "0x3004 0x1000 isaligned", []any{uint64(0)}, ""},
+		{"ispow2", "64 u8 ispow2", []any{uint64(1)}, ""},
+		{"ispow2 zero", "0 ispow2", []any{uint64(0)}, ""},
+		{"ispow2 not", "96 ispow2", []any{uint64(0)}, ""},
+		{"nextpow2", "65 u8 nextpow2", []any{uint8(128)}, ""},
+		{"nextpow2 exact", "64 nextpow2", []any{uint64(64)}, ""},
+		{"nextpow2 overflow", "200 u8 nextpow2", nil, "nextpow2 of 200 overflows uint8"},
+		{"prevpow2", "65 prevpow2", []any{uint64(64)}, ""},
+		{"prevpow2 zero", "0 prevpow2", nil, "prevpow2 of non-positive value"},
+
+		// Bit shuffles
+		{"pdep", "0b101 u8 0xf0 pdep", []any{uint8(0x50)}, ""},
+		{"pdep sparse", "0b11 0b10010000 pdep", []any{uint64(0b10010000)}, ""},
+		{"pext", "0x5a u8 0xf0 pext", []any{uint8(0x5)}, ""},
+		{"pext untyped negative", "-1 0xff pext", []any{uint64(0xff)}, ""},
+		{"pext 128 bit", "-1 i128 0xf000000000000000f pext", []any{Int128{0, 0xff}}, ""},
+		{"pdep float", "1.0 f32 1 pdep", nil, "pdep needs integers, not float32"},
+		{"zip", "0xffff0000 u32 zip", []any{uint32(0xaaaaaaaa)}, ""},
+		{"zip morton", "0b11 8 << 0b01 | u16 zip", []any{uint16(0b1011)}, ""},
+		{"unzip", "0xaaaaaaaa u32 unzip", []any{uint32(0xffff0000)}, ""},
+		{"zip odd width", "1 u5 zip", nil, "zip needs an even width, not 5"},
+		{"bperm", "0b0001 u8 3 2 1 0 4 bperm", []any{uint8(0b1000)}, ""},
+		{"bperm broadcast", "0b10 u8 1 1 1 3 bperm", []any{uint8(0b111)}, ""},
+		{"bperm out of range", "1 u8 8 1 bperm", nil, "bit 8 out of range for 8 bit value"},
+		{"bperm missing indexes", "1 0 0 3 bperm", nil, "bperm needs a value and 3 indexes"},
 		{"shl", "1 8 <<", []any{uint64(256)}, ""},
 		{"shr", "256 4 >>", []any{uint64(16)}, ""},
+		{"shl over-wide", "1 u8 9 <<", []any{uint8(0)}, ""},
+		{"shr over-wide signed", "-1 i8 100 >>", []any{int8(-1)}, ""},
+		{"shl negative count", "4 u8 -1 <<", []any{uint8(2)}, ""},
+		{"lshr signed", "-128 i8 1 >>>", []any{int8(0x40)}, ""},
+		{"lshr untyped", "-1 1 >>>", []any{uint64(1<<63 - 1)}, ""},
+		{"ashr unsigned", "0x80 u8 1 >>a", []any{uint8(0xc0)}, ""},
+		{"ashr over-wide", "0x80 u8 9 >>a", []any{uint8(0xff)}, ""},
+		{"lshr over-wide", "0x80 u8 9 >>>", []any{uint8(0)}, ""},
+		{"shiftmask", "32 31 shiftmask 1 u32 33 <<", []any{uint32(2)}, ""},
+		{"shiftmask negative count", "32 31 shiftmask 0x80000000 u32 -1 >>>", []any{uint32(1)}, ""},
+		{"shiftmask other width", "32 31 shiftmask 1 u64 33 <<", []any{uint64(1 << 33)}, ""},
+		{"noshiftmask", "32 31 shiftmask 32 noshiftmask 1 u32 33 <<", []any{uint32(0)}, ""},
 
 		// Unary Operations
 		{"negate", "10 neg", []any{int64(-10)}, ""},
@@ -79,10 +504,193 @@ func TestRun(t *testing.T) {
 		{"uint8 overflow", "255 u8 1 +", []any{uint8(0)}, ""},
 		{"int8 max", "i8max", []any{int8(math.MaxInt8)}, ""},
 		{"int32 overflow", "i32max 1 +", []any{int32(math.MinInt32)}, ""},
+
+		// 128 bit integers
+		{"u128 literal", "0x100000000000000000000", []any{Uint128{0x10000, 0}}, ""},
+		{"i128 literal", "-18446744073709551617", []any{Int128{-2, math.MaxUint64}}, ""},
+		{"u128 conv", "-1 u128", []any{Uint128{math.MaxUint64, math.MaxUint64}}, ""},
+		{"i128 conv", "u64max i128", []any{Int128{0, math.MaxUint64}}, ""},
+		{"u128 overflow", "u128max 1 +", []any{Uint128{0, 0}}, ""},
+		{"i128 overflow", "i128max 1 +", []any{Int128{math.MinInt64, 0}}, ""},
+		{"u128 mul", "u64max u128 u64max *", []any{Uint128{math.MaxUint64 - 1, 1}}, ""},
+		{"i128 div", "-1 i128 64 << 3 /", []any{Int128{-1, 0xaaaaaaaaaaaaaaab}}, ""},
+		{"u128 shl", "1 u128 100 <<", []any{Uint128{1 << 36, 0}}, ""},
+		{"i128 shr", "i128min 127 >>", []any{Int128{-1, math.MaxUint64}}, ""},
+		{"u128 not", "0 u128 ~", []any{Uint128{math.MaxUint64, math.MaxUint64}}, ""},
+		{"i128 and", "-1 i128 0xff &", []any{Int128{0, 0xff}}, ""},
+		{"u128 to u64", "u128max u64", []any{uint64(math.MaxUint64)}, ""},
+		{"u128 to f64", "u128max f64", []any{float64(0x1p128)}, ""},
+
+		// Untyped integers
+		{"untyped exp", "2 200 **", []any{bigInt("1606938044258990275541962092341162602522202993782792835301376")}, ""},
+		{"untyped mul", "18446744073709551615 dup *", []any{bigInt("340282366920938463426481119284349108225")}, ""},
+		{"untyped narrow", "2 200 ** 1 + 2 200 ** -", []any{uint64(1)}, ""},
+		{"untyped negative", "2 5 -", []any{int64(-3)}, ""},
+		{"untyped truncate", "2 200 ** 3 + u8", []any{uint8(3)}, ""},
+		{"untyped truncate signed", "2 100 ** 1 - ! i32", []any{int32(1)}, ""},
+		{"untyped shl", "1 100 << 98 >>", []any{uint64(4)}, ""},
+		{"untyped shr negative", "-1 100 << 200 >>", []any{int64(-1)}, ""},
+		{"untyped or", "1 100 << 0xff |", []any{bigInt("1267650600228229401496703205631")}, ""},
+		{"untyped not", "1 100 << ~", []any{bigInt("-1267650600228229401496703205377")}, ""},
+		{"untyped and negative", "-1 100 << 0xffff &", []any{uint64(0)}, ""},
+		{"untyped to float", "2 100 ** f64", []any{float64(0x1p100)}, ""},
+		{"untyped literal", "0x100000000000000000000000000000000", []any{bigInt("340282366920938463463374607431768211456")}, ""},
+		{"u128 literal exact", "0x100000000000000000000 dup *", []any{bigInt("1461501637330902918203684832716283019655932542976")}, ""},
+		{"untyped with typed", "2 100 ** 5 + u8 3 +", []any{uint8(8)}, ""},
+		{"typed still wraps", "u64max u64max *", []any{uint64(1)}, ""},
+		{"untyped too large", "2 100000 **", nil, "untyped integer too large"},
+		{"untyped divide by zero", "1 100 << 0 /", nil, "integer divide by zero"},
+
+		// Arbitrary width integers
+		{"u12 conv", "0x1234 u12", []any{UintN{0x234, 12}}, ""},
+		{"i5 conv", "31 i5", []any{IntN{-1, 5}}, ""},
+		{"u12 overflow", "4095 u12 1 +", []any{UintN{0, 12}}, ""},
+		{"i7 overflow", "63 i7 1 +", []any{IntN{-64, 7}}, ""},
+		{"u48 promotion", "1 u12 1 u48 +", []any{UintN{2, 48}}, ""},
+		{"i5 u12 promotion", "3 u12 5 i5 -", []any{IntN{-2, 12}}, ""},
+		{"u12 not", "0x123 u12 ~", []any{UintN{0xedc, 12}}, ""},
+		{"i3 shl", "1 i3 2 <<", []any{IntN{-4, 3}}, ""},
+		{"i12 bits", "-3 i12 bits", []any{UintN{0xffd, 12}}, ""},
+		{"u12 to u8", "0xfff u12 u8", []any{uint8(0xff)}, ""},
+		{"invalid width", "1 u65", nil, `syntax error at "u65"`},
+
+		// Half precision floats
+		{"f16 conv", "1.5 f16", []any{Float{Float16, Uint128{0, 0x3e00}}}, ""},
+		{"f16 round to even", "2049 f16", []any{Float{Float16, Uint128{0, 0x6800}}}, ""},
+		{"f16 round up", "2051 f16", []any{Float{Float16, Uint128{0, 0x6802}}}, ""},
+		{"f16 overflow", "65520 f16", []any{Float{Float16, Uint128{0, 0x7c00}}}, ""},
+		{"f16 max", "65519 f16", []any{Float{Float16, Uint128{0, 0x7bff}}}, ""},
+		{"f16 subnormal", "0x3p-25 f16", []any{Float{Float16, Uint128{0, 0x0002}}}, ""},
+		{"f16 underflow", "0x1p-25 f16", []any{Float{Float16, Uint128{0, 0x0000}}}, ""},
+		{"f16 negative zero", "-0.0 f16", []any{Float{Float16, Uint128{0, 0x8000}}}, ""},
+		{"f16 nan", "0.0 0.0 / f16", []any{Float{Float16, Uint128{0, 0x7e00}}}, ""},
+		{"f16 div", "1 f16 3 /", []any{Float{Float16, Uint128{0, 0x3555}}}, ""},
+		{"f16 add overflow", "f16max f16max +", []any{Float{Float16, Uint128{0, 0x7c00}}}, ""},
+		{"f16 fbits", "0x3c00 u16 fbits", []any{Float{Float16, Uint128{0, 0x3c00}}}, ""},
+		{"f16 bits", "f16minsubnorm bits", []any{uint16(1)}, ""},
+		{"f16 to f32", "0.1 f16 f32", []any{float32(0x1.998p-4)}, ""},
+		{"f16 f32 promotion", "1 f16 2.5 f32 +", []any{float32(3.5)}, ""},
+		{"bf16 conv", "0.1 bf16", []any{Float{BFloat16, Uint128{0, 0x3dcd}}}, ""},
+		{"bf16 fbits", "0x3f80 u16 bf16fbits", []any{Float{BFloat16, Uint128{0, 0x3f80}}}, ""},
+		{"bf16 max", "bf16max f64", []any{float64(0x1.fep127)}, ""},
+		{"bf16 f16 promotion", "1 bf16 2 f16 +", []any{float32(3)}, ""},
+		{"f16 bf16 promotion", "bf16max 1 f16 -", []any{float32(0x1.fep127)}, ""},
+		{"f16 fbits", "0x3c00 u16 fbits", []any{Float{Float16, Uint128{0, 0x3c00}}}, ""},
+		{"e4m3 fbits", "0x38 u8 fbits", []any{Float{E4M3, Uint128{0, 0x38}}}, ""},
+
+		// 8 bit floats
+		{"e4m3 conv", "0.3 e4m3", []any{Float{E4M3, Uint128{0, 0x2a}}}, ""},
+		{"e4m3 max", "448 e4m3", []any{Float{E4M3, Uint128{0, 0x7e}}}, ""},
+		{"e4m3 round to max", "464 e4m3", []any{Float{E4M3, Uint128{0, 0x7e}}}, ""},
+		{"e4m3 overflow", "470 e4m3", []any{Float{E4M3, Uint128{0, 0x7f}}}, ""},
+		{"e4m3 inf", "1. 0. / e4m3", []any{Float{E4M3, Uint128{0, 0x7f}}}, ""},
+		{"e4m3 sat", "1000 e4m3sat", []any{Float{E4M3, Uint128{0, 0x7e}}}, ""},
+		{"e4m3 sat negative", "-1000 e4m3sat", []any{Float{E4M3, Uint128{0, 0xfe}}}, ""},
+		{"e4m3 sat inf", "-1. 0. / e4m3sat", []any{Float{E4M3, Uint128{0, 0xfe}}}, ""},
+		{"e4m3 add overflow", "e4m3max e4m3max +", []any{Float{E4M3, Uint128{0, 0x7f}}}, ""},
+		{"e4m3 fbits", "0x38 u8 fbits", []any{Float{E4M3, Uint128{0, 0x38}}}, ""},
+		{"e4m3 bits", "e4m3minsubnorm bits", []any{uint8(1)}, ""},
+		{"e5m2 conv", "0.3 e5m2", []any{Float{E5M2, Uint128{0, 0x35}}}, ""},
+		{"e5m2 overflow", "1e6 e5m2", []any{Float{E5M2, Uint128{0, 0x7c}}}, ""},
+		{"e5m2 sat", "1e6 e5m2sat", []any{Float{E5M2, Uint128{0, 0x7b}}}, ""},
+		{"e5m2 sat inf", "1. 0. / e5m2sat", []any{Float{E5M2, Uint128{0, 0x7b}}}, ""},
+		{"e5m2 fbits", "0x7c u8 e5m2fbits", []any{Float{E5M2, Uint128{0, 0x7c}}}, ""},
+		{"e5m2 to f32", "e5m2max f32", []any{float32(57344)}, ""},
+		{"e4m3 e5m2 promotion", "1 e5m2 1 e4m3 +", []any{Float{Float16, Uint128{0, 0x4000}}}, ""},
+
+		// Extended precision floats
+		{"f80 conv", "1 f80", []any{Float{Float80, Uint128{0x3fff, 1 << 63}}}, ""},
+		{"f80 div", "1 f80 3 /", []any{Float{Float80, Uint128{0x3ffd, 0xaaaaaaaaaaaaaaab}}}, ""},
+		{"f80 overflow", "f80max 2 *", []any{Float{Float80, Uint128{0x7fff, 1 << 63}}}, ""},
+		{"f80 nan", "0.0 0.0 / f80", []any{Float{Float80, Uint128{0x7fff, 0xc000000000000000}}}, ""},
+		{"f80 subnormal", "f80minnorm 2 /", []any{Float{Float80, Uint128{0, 1 << 62}}}, ""},
+		{"f80 fbits", "0x3fff8000000000000000 u128 f80fbits f64", []any{float64(1)}, ""},
+		{"f80 pseudo-denormal", "0x00008000000000000000 u128 f80fbits f80minnorm -", []any{Float{Float80, Uint128{0, 0}}}, ""},
+		{"f80 unnormal", "0x3fff0000000000000000 u128 f80fbits 1 +", []any{Float{Float80, Uint128{0x7fff, 0xc000000000000000}}}, ""},
+		{"f80 bits", "1.5 f80 bits", []any{Uint128{0x3fff, 0xc000000000000000}}, ""},
+		{"f128 conv", "1 f128", []any{Float{Float128, Uint128{0x3fff000000000000, 0}}}, ""},
+		{"f128 div", "1 f128 3 /", []any{Float{Float128, Uint128{0x3ffd555555555555, 0x5555555555555555}}}, ""},
+		{"f128 exact add", "1 f128 0x1p-112 + 1 - 0x1p112 *", []any{Float{Float128, Uint128{0x3fff000000000000, 0}}}, ""},
+		{"f128 pow", "3 f128 70 ** i128", []any{Int128FromBig(new(big.Int).Exp(big.NewInt(3), big.NewInt(70), nil))}, ""},
+		{"pow overflow", "10 f32 1e30 f32 **", []any{float32(math.Inf(1))}, ""},
+		{"pow underflow", "0.5 f16 1e30 ** bits", []any{uint16(0)}, ""},
+		{"f128 fbits", "0x3fff0000000000000000000000000000 u128 fbits", []any{Float{Float128, Uint128{0x3fff000000000000, 0}}}, ""},
+		{"f128 to f80", "f80max f128 f80", []any{Float{Float80, Uint128{0x7ffe, math.MaxUint64}}}, ""},
+		{"f80 f128 promotion", "1 f80 1 f128 +", []any{Float{Float128, Uint128{0x4000000000000000, 0}}}, ""},
+
+		// User defined floats
+		{"fmt conv", "fmt e3m4 bias=3 noinf 1.5 e3m4 bits", []any{uint8(0x38)}, ""},
+		{"fmt noinf overflow", "fmt e3m4 bias=3 noinf 100 e3m4 bits", []any{uint8(0x7f)}, ""},
+		{"fmt sat", "fmt e3m4 bias=3 noinf 100 e3m4sat f64", []any{float64(30)}, ""},
+		{"fmt max", "fmt e3m4 bias=3 noinf e3m4max f64", []any{float64(30)}, ""},
+		{"fmt minsubnorm", "fmt e3m4 bias=3 noinf e3m4minsubnorm f64", []any{float64(0x1p-6)}, ""},
+		{"fmt fbits", "fmt e3m4 bias=3 noinf 0x38 u8 e3m4fbits f64", []any{float64(1.5)}, ""},
+		{"fmt default bias", "fmt e5m10 1 e5m10 f16 bits", []any{uint16(0x3c00)}, ""},
+		{"fmt ieee overflow", "fmt e5m10 1e6 e5m10 bits", []any{uint16(0x7c00)}, ""},
+		{"fmt finite", "fmt e2m1 finite 100 e2m1 bits", []any{NewUintN(0x7, 4)}, ""},
+		{"fmt finite nan", "fmt e2m1 finite 0.0 0.0 / e2m1", nil, "e2m1 has no NaN"},
+		{"fmt explicit", "fmt e15m63 explicit 1 e15m63 bits", []any{Uint128{0x3fff, 1 << 63}}, ""},
+		{"fmt arithmetic", "fmt e3m4 bias=3 noinf 1 e3m4 3 / f64", []any{float64(0x1.5p-2)}, ""},
+		{"fmt named", "fmt tiny exp=2 man=2 bias=1 1.75 tiny f64", []any{float64(1.75)}, ""},
+		{"fmt needs widths", "fmt tiny", nil, "needs exp= and man="},
+		{"fmt name conflict", "fmt dump exp=2 man=2", nil, "conflicts with existing commands"},
+		{"fmt name conflict type", "fmt u12 exp=2 man=2", nil, "conflicts with existing commands"},
+		{"fmt name command prefix", "fmt dlfloat exp=6 man=9 1.5 dlfloat bits", []any{uint16(0x3f00)}, ""},
+		{"fmt name constant prefix", "fmt minifloat exp=4 man=3 minifloatmax f64", []any{float64(240)}, ""},
+		{"fmt too wide", "fmt e30m100", nil, "at most 128 bits"},
+		{"fmt name width out of range", "fmt e99999999999999999999m1", nil, "value out of range"},
+		{"fmt option out of range", "fmt tiny exp=2 man=99999999999999999999", nil, "option man"},
+
+		// Fixed point
+		{"q15 conv", "0.5 q15", []any{Fixed{QFormat{1, 15, true}, 0x4000, 0}}, ""},
+		{"q15 round", "0.1 q15 bits", []any{uint16(3277)}, ""},
+		{"q15 negative", "-0.5 q15 bits", []any{uint16(0xc000)}, ""},
+		{"q15 saturate", "1 q15", []any{Fixed{QFormat{1, 15, true}, 0x7fff, -0x1p-15}}, ""},
+		{"q15 saturate negative", "-2 q15", []any{Fixed{QFormat{1, 15, true}, 0x8000, 1}}, ""},
+		{"q1.31 conv", "0.25 q1.31 bits", []any{uint32(0x20000000)}, ""},
+		{"uq8.8 conv", "3.14159 uq8.8 bits", []any{uint16(0x0324)}, ""},
+		{"uq8.8 saturate negative", "-1 uq8.8 bits", []any{uint16(0)}, ""},
+		{"q15 raw", "0x8000 q15raw f64", []any{float64(-1)}, ""},
+		{"q15 mul", "0.5 q15 0.5 q15 *", []any{Fixed{QFormat{1, 15, true}, 0x2000, 0}}, ""},
+		{"q15 mul saturate", "-1 q15 -1 q15 * bits", []any{uint16(0x7fff)}, ""},
+		{"q15 mul round", "0x0001 q15raw 0x4000 q15raw * bits", []any{uint16(1)}, ""},
+		{"q15 mul round negative", "0xffff q15raw 0x4000 q15raw * bits", []any{uint16(0)}, ""},
+		{"q15 add saturate", "0.75 q15 0.5 + bits", []any{uint16(0x7fff)}, ""},
+		{"q15 div", "0.5 q15 4 / bits", []any{uint16(0x1000)}, ""},
+		{"q15 div by zero", "-0.5 q15 0 / bits", []any{uint16(0x8000)}, ""},
+		{"q15 shift", "0.5 q15 2 >> bits", []any{uint16(0x1000)}, ""},
+		{"q15 neg", "-1 q15 ! bits", []any{uint16(0x7fff)}, ""},
+		{"q15 to int", "-1.5 q3.13 i8", []any{int8(-1)}, ""},
+		{"q15 bitwise", "0x1234 q15raw 0xff & bits", []any{uint16(0x34)}, ""},
+		{"q mismatch", "0.5 q15 0.5 q31 +", nil, "mismatched fixed point formats"},
+		{"q nan", "0.0 0.0 / q15", nil, "q1.15 has no NaN"},
+		{"q too wide", "1 q64", nil, "from 1 to 64 bits"},
+
+		// Exact mode
+		{"exact literal", "exact 0.1", []any{big.NewRat(1, 10)}, ""},
+		{"exact add", "exact 0.1 0.2 + 0.3 -", []any{big.NewRat(0, 1)}, ""},
+		{"exact div", "exact 1 3.0 /", []any{big.NewRat(1, 3)}, ""},
+		{"exact int div", "exact 1 3 /", []any{uint64(0)}, ""},
+		{"exact pow", "exact 0.5 -3 **", []any{big.NewRat(8, 1)}, ""},
+		{"exact pow fraction", "exact 4.0 0.5 **", []any{float64(2)}, ""},
+		{"exact div by zero", "exact 1.0 0 /", []any{math.Inf(1)}, ""},
+		{"exact shift", "exact 0.75 3 >>", []any{big.NewRat(3, 32)}, ""},
+		{"exact hex literal", "exact 0x1.8p-1", []any{big.NewRat(3, 4)}, ""},
+		{"exact f32 single rounding", "exact 1.00000005960464477539063 f32", []any{float32(1.0000001)}, ""},
+		{"inexact f32 double rounding", "1.00000005960464477539063 f32", []any{float32(1)}, ""},
+		{"exact typed operand", "exact 1 f32 0.1 +", []any{float32(1.1)}, ""},
+		{"exact f16", "exact 0.1 f16 bits", []any{uint16(0x2e66)}, ""},
+		{"exact q15", "exact 0.1 q15 bits", []any{uint16(3277)}, ""},
+		{"exact to int", "exact 2.75 i8", []any{int8(2)}, ""},
+		{"exact out of float64 range", "exact 1e400 f64", []any{math.Inf(1)}, ""},
+		{"inexact", "exact inexact 0.1", []any{float64(0.1)}, ""},
+		{"exact too large", "exact 1e-100000", nil, "untyped rational too large"},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
+			saved := maps.Clone(formats)
+			t.Cleanup(func() { exactMode, checkedMode, shiftMasks, formats = false, false, map[int]int64{}, saved })
 			var stack Stack
 			input := stringInput(tc.script)
 			_, err := run(&stack, input)
@@ -123,6 +731,10 @@ func TestRun(t *testing.T) {
 					} else {
 						t.Errorf("stack item %d: expected type float64, but got %T", i, got)
 					}
+				} else if rexp, ok := expected.(*big.Rat); ok {
+					if rgot, ok2 := got.(*big.Rat); !ok2 || rexp.Cmp(rgot) != 0 {
+						t.Errorf("stack item %d: expected %v (%T), but got %v (%T)", i, rexp, rexp, got, got)
+					}
 				} else if !reflect.DeepEqual(expected, got) {
 					t.Errorf("stack item %d: expected %v (%T), but got %v (%T)", i, expected, expected, got, got)
 				}
@@ -131,6 +743,54 @@ func TestRun(t *testing.T) {
 	}
 }
 
+func TestFormatDefinitionError(t *testing.T) {
+	saved := maps.Clone(formats)
+	t.Cleanup(func() { formats = saved })
+	var stack Stack
+	if _, err := run(&stack, stringInput("fmt tiny exp=2 man=2 1 tiny $")); err == nil {
+		t.Fatal("expected a syntax error, but got none")
+	}
+	if _, ok := formats["tiny"]; ok {
+		t.Error("format defined by a script which failed to tokenize")
+	}
+}
+
+func TestFclass(t *testing.T) {
+	testCases := []struct {
+		script string
+		class  string
+		mask   uint16
+	}{
+		{"1.0 0.0 / neg", "-inf", 1 << 0},
+		{"-1.0", "-normal", 1 << 1},
+		{"-5e-324", "-subnormal", 1 << 2},
+		{"-0.0", "-zero", 1 << 3},
+		{"0.0 f32", "+zero", 1 << 4},
+		{"0 0 1 mkfloat f32", "+subnormal", 1 << 5},
+		{"1", "+normal", 1 << 6},
+		{"f64max nextup", "+inf", 1 << 7},
+		{"0 255 1 mkfloat f32", "sNaN", 1 << 8},
+		{"snan 1 f32", "sNaN", 1 << 8},
+		{"0.0 0.0 /", "qNaN", 1 << 9},
+		{"qnan 0 e4m3", "qNaN", 1 << 9},
+	}
+	for _, tc := range testCases {
+		var stack Stack
+		if _, err := run(&stack, stringInput(tc.script)); err != nil && err != io.EOF {
+			t.Fatalf("%s: unexpected error: %v", tc.script, err)
+		}
+		if got := formatClass(stack.Top()); !strings.Contains(got, tc.class+"\n") {
+			t.Errorf("%s: expected class %s, but got %q", tc.script, tc.class, got)
+		}
+		if _, err := run(&stack, stringInput("fclass")); err != nil && err != io.EOF {
+			t.Fatalf("%s fclass: unexpected error: %v", tc.script, err)
+		}
+		if got := stack.Top(); !reflect.DeepEqual(got, Num{tc.mask, true}) {
+			t.Errorf("%s fclass: expected mask %#x, but got %v (%T)", tc.script, tc.mask, got.val, got.val)
+		}
+	}
+}
+
 func TestTokenize(t *testing.T) {
 	testCases := []struct {
 		name           string
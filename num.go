@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"math/big"
+	"math/bits"
 )
 
 type Num struct {
@@ -11,13 +14,31 @@ type Num struct {
 }
 
 func (n Num) Bits() int {
-	switch n.val.(type) {
+	switch val := n.val.(type) {
 	case int8, uint8:
 		return 8
 	case int16, uint16:
 		return 16
 	case int32, uint32, float32:
 		return 32
+	case Int128, Uint128:
+		return 128
+	case IntN:
+		return val.N
+	case UintN:
+		return val.N
+	case Float:
+		return val.F.Bits()
+	case Fixed:
+		return val.Q.Bits()
+	case *big.Int:
+		// Untyped integers grow in steps of 64 bits as needed to hold their
+		// two's complement representation.
+		bits := val.BitLen()
+		if val.Sign() < 0 {
+			bits++
+		}
+		return (bits + 63) / 64 * 64
 	default:
 		return 64
 	}
@@ -44,9 +65,13 @@ func (n Num) WithBits(bits int) Num {
 			return Num{int32(n.Int()), n.typed}
 		case 64:
 			return Num{n.Int(), n.typed}
-		default:
+		case 128:
+			return Num{n.AsInt128(), n.typed}
+		}
+		if bits < 1 || bits > 64 {
 			panic("invalid int bits")
 		}
+		return Num{NewIntN(n.Int(), bits), n.typed}
 	}
 	switch bits {
 	case 8:
@@ -57,14 +82,42 @@ func (n Num) WithBits(bits int) Num {
 		return Num{uint32(n.Uint()), n.typed}
 	case 64:
 		return Num{n.Uint(), n.typed}
-	default:
+	case 128:
+		return Num{n.AsUint128(), n.typed}
+	}
+	if bits < 1 || bits > 64 {
 		panic("invalid uint bits")
 	}
+	return Num{NewUintN(n.Uint(), bits), n.typed}
+}
+
+// Type returns the name of n's type.
+func (n Num) Type() string {
+	switch val := n.val.(type) {
+	case Int128:
+		return "int128"
+	case Uint128:
+		return "uint128"
+	case IntN:
+		return fmt.Sprintf("int%d", val.N)
+	case UintN:
+		return fmt.Sprintf("uint%d", val.N)
+	case Float:
+		return val.F.Name
+	case Fixed:
+		return val.Q.String()
+	case *big.Int:
+		return "bigint"
+	case *big.Rat:
+		return "rational"
+	default:
+		return fmt.Sprintf("%T", n.val)
+	}
 }
 
 func (n Num) CanFloat() bool {
 	switch n.val.(type) {
-	case float32, float64:
+	case float32, float64, Float, *big.Rat:
 		return true
 	default:
 		return false
@@ -77,15 +130,61 @@ func (n Num) Float() float64 {
 		return float64(val)
 	case float64:
 		return val
+	case Float:
+		if val.F.IsNaN(val.Bits) {
+			return math.NaN()
+		}
+		f, _ := val.F.Decode(val.Bits).Float64()
+		return f
+	case *big.Rat:
+		f, _ := val.Float64()
+		return f
 	default:
 		panic("not a float")
 	}
 }
 
+func (n Num) IsNaN() bool {
+	switch val := n.val.(type) {
+	case float32, float64:
+		return math.IsNaN(n.Float())
+	case Float:
+		return val.F.IsNaN(val.Bits)
+	default:
+		return false
+	}
+}
+
+// AsBigFloat returns the exact value of n, which must not be a NaN. Rationals
+// are rounded to 256 bits.
+func (n Num) AsBigFloat() *big.Float {
+	switch val := n.val.(type) {
+	case float32:
+		return big.NewFloat(float64(val))
+	case float64:
+		return big.NewFloat(val)
+	case Float:
+		return val.F.Decode(val.Bits)
+	case Fixed:
+		return new(big.Float).SetRat(val.Rat())
+	case *big.Rat:
+		return new(big.Float).SetPrec(256).SetRat(val)
+	default:
+		return new(big.Float).SetInt(n.AsBig())
+	}
+}
+
 func (n Num) AsFloat() float64 {
+	if v, ok := n.val.(Fixed); ok {
+		f, _ := v.Rat().Float64()
+		return f
+	}
 	switch {
 	case n.CanFloat():
 		return n.Float()
+	case n.Bits() > 64:
+		f, _ := new(big.Float).SetInt(n.AsBig()).Float64()
+		return f
 	case n.CanInt():
 		return float64(n.Int())
 	default:
@@ -94,9 +193,11 @@ func (n Num) AsFloat() float64 {
 }
 
 func (n Num) CanInt() bool {
-	switch n.val.(type) {
-	case int8, int16, int32, int64:
+	switch val := n.val.(type) {
+	case int8, int16, int32, int64, Int128, IntN:
 		return true
+	case *big.Int:
+		return val.Sign() < 0
 	default:
 		return false
 	}
@@ -112,6 +213,12 @@ func (n Num) Int() int64 {
 		return int64(val)
 	case int64:
 		return val
+	case Int128:
+		return int64(val.Lo)
+	case IntN:
+		return val.V
+	case *big.Int:
+		return int64(Uint128FromBig(val).Lo)
 	default:
 		panic("not an int")
 	}
@@ -119,6 +226,8 @@ func (n Num) Int() int64 {
 
 func (n Num) AsInt() int64 {
 	switch {
+	case fixedPoint(n):
+		return n.AsBig().Int64()
 	case n.CanFloat():
 		return int64(n.Float())
 	case n.CanInt():
@@ -129,9 +238,11 @@ func (n Num) AsInt() int64 {
 }
 
 func (n Num) CanUint() bool {
-	switch n.val.(type) {
-	case uint8, uint16, uint32, uint64:
+	switch val := n.val.(type) {
+	case uint8, uint16, uint32, uint64, Uint128, UintN:
 		return true
+	case *big.Int:
+		return val.Sign() >= 0
 	default:
 		return false
 	}
@@ -147,6 +258,12 @@ func (n Num) Uint() uint64 {
 		return uint64(val)
 	case uint64:
 		return val
+	case Uint128:
+		return val.Lo
+	case UintN:
+		return val.V
+	case *big.Int:
+		return Uint128FromBig(val).Lo
 	default:
 		panic(fmt.Errorf("not an uint: %T(%#v)", n.val, n.val))
 	}
@@ -154,6 +271,8 @@ func (n Num) Uint() uint64 {
 
 func (n Num) AsUint() uint64 {
 	switch {
+	case fixedPoint(n):
+		return n.AsBig().Uint64()
 	case n.CanFloat():
 		return uint64(n.Float())
 	case n.CanInt():
@@ -163,27 +282,135 @@ func (n Num) AsUint() uint64 {
 	}
 }
 
+// AsBig returns the integer value of n. Floats are truncated toward zero.
+func (n Num) AsBig() *big.Int {
+	switch val := n.val.(type) {
+	case Int128:
+		return val.Big()
+	case Uint128:
+		return val.Big()
+	case Float:
+		if x := val.F; !x.IsNaN(val.Bits) && !x.IsInf(val.Bits) {
+			i, _ := x.Decode(val.Bits).Int(nil)
+			return i
+		}
+	case Fixed:
+		r := val.Rat()
+		return new(big.Int).Quo(r.Num(), r.Denom())
+	case *big.Int:
+		return val
+	case *big.Rat:
+		return new(big.Int).Quo(val.Num(), val.Denom())
+	}
+	switch {
+	case n.CanFloat():
+		f := n.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return big.NewInt(int64(f))
+		}
+		i, _ := big.NewFloat(f).Int(nil)
+		return i
+	case n.CanInt():
+		return big.NewInt(n.Int())
+	default:
+		return new(big.Int).SetUint64(n.Uint())
+	}
+}
+
+// AsRat returns the exact value of n, which must be a rational or an integer.
+func (n Num) AsRat() *big.Rat {
+	if r, ok := n.val.(*big.Rat); ok {
+		return r
+	}
+	return new(big.Rat).SetInt(n.AsBig())
+}
+
+func (n Num) AsInt128() Int128 {
+	return Int128FromBig(n.AsBig())
+}
+
+func (n Num) AsUint128() Uint128 {
+	return Uint128FromBig(n.AsBig())
+}
+
 func (n Num) AsBits() uint64 {
 	switch val := n.val.(type) {
 	case float32:
 		return uint64(math.Float32bits(val))
-	case float64:
+	case float64, *big.Rat:
 		return math.Float64bits(n.AsFloat())
+	case Float:
+		return val.Bits.Lo
+	case Fixed:
+		return val.Raw
 	default:
 		return n.AsUint()
 	}
 }
 
-func (n Num) OpI8() Num  { return Num{int8(n.AsInt()), true} }
-func (n Num) OpI16() Num { return Num{int16(n.AsInt()), true} }
-func (n Num) OpI32() Num { return Num{int32(n.AsInt()), true} }
-func (n Num) OpI64() Num { return Num{int64(n.AsInt()), true} }
-func (n Num) OpU8() Num  { return Num{uint8(n.AsUint()), true} }
-func (n Num) OpU16() Num { return Num{uint16(n.AsUint()), true} }
-func (n Num) OpU32() Num { return Num{uint32(n.AsUint()), true} }
-func (n Num) OpU64() Num { return Num{uint64(n.AsUint()), true} }
-func (n Num) OpF32() Num { return Num{float32(n.AsFloat()), true} }
-func (n Num) OpF64() Num { return Num{float64(n.AsFloat()), true} }
+// AsBits128 is like AsBits, but keeps every bit of values wider than 64 bits.
+func (n Num) AsBits128() Uint128 {
+	switch val := n.val.(type) {
+	case Float:
+		return val.Bits
+	case Int128:
+		return val.Uint128()
+	case Uint128:
+		return val
+	case *big.Int:
+		return Uint128FromBig(val)
+	default:
+		return Uint128{0, n.AsBits()}
+	}
+}
+
+func (n Num) OpI8() Num   { return Num{int8(n.AsInt()), true} }
+func (n Num) OpI16() Num  { return Num{int16(n.AsInt()), true} }
+func (n Num) OpI32() Num  { return Num{int32(n.AsInt()), true} }
+func (n Num) OpI64() Num  { return Num{int64(n.AsInt()), true} }
+func (n Num) OpU8() Num   { return Num{uint8(n.AsUint()), true} }
+func (n Num) OpU16() Num  { return Num{uint16(n.AsUint()), true} }
+func (n Num) OpU32() Num  { return Num{uint32(n.AsUint()), true} }
+func (n Num) OpU64() Num  { return Num{uint64(n.AsUint()), true} }
+func (n Num) OpI128() Num { return Num{n.AsInt128(), true} }
+func (n Num) OpU128() Num { return Num{n.AsUint128(), true} }
+func (n Num) OpF32() Num  { return floatNum(Binary32, Binary32.FromNum(n), true) }
+func (n Num) OpF64() Num  { return floatNum(Binary64, Binary64.FromNum(n), true) }
+func (n Num) OpF16() Num  { return Num{Float{Float16, Float16.FromNum(n)}, true} }
+func (n Num) OpBF16() Num { return Num{Float{BFloat16, BFloat16.FromNum(n)}, true} }
+func (n Num) OpF80() Num  { return Num{Float{Float80, Float80.FromNum(n)}, true} }
+func (n Num) OpF128() Num { return Num{Float{Float128, Float128.FromNum(n)}, true} }
+func (n Num) OpE4M3() Num { return Num{Float{E4M3, E4M3.FromNum(n)}, true} }
+func (n Num) OpE5M2() Num { return Num{Float{E5M2, E5M2.FromNum(n)}, true} }
+
+// OpFloat converts to f, saturating values outside of its range if sat is
+// set.
+func (n Num) OpFloat(f *FloatFormat, sat bool) Num {
+	if sat {
+		return floatNum(f, f.FromNumSat(n), true)
+	}
+	return floatNum(f, f.FromNum(n), true)
+}
+
+// OpE4M3Sat converts to E4M3, saturating values outside of its range.
+func (n Num) OpE4M3Sat() Num { return Num{Float{E4M3, E4M3.FromNumSat(n)}, true} }
+
+// OpE5M2Sat converts to E5M2, saturating values outside of its range.
+func (n Num) OpE5M2Sat() Num { return Num{Float{E5M2, E5M2.FromNumSat(n)}, true} }
+
+// OpFixed converts to the fixed point format q, rounding to nearest and
+// saturating.
+func (n Num) OpFixed(q QFormat) Num { return Num{q.FromNum(n), true} }
+
+// OpFixedRaw reinterprets the low bits of n as the underlying integer of a
+// value in the fixed point format q.
+func (n Num) OpFixedRaw(q QFormat) Num { return Num{q.FromRaw(n.AsBits()), true} }
+
+// OpInt converts to a signed integer of any supported width.
+func (n Num) OpInt(bits int) Num { return Num{n.AsInt(), true}.WithBits(bits) }
+
+// OpUint converts to an unsigned integer of any supported width.
+func (n Num) OpUint(bits int) Num { return Num{n.AsUint(), true}.WithBits(bits) }
 
 type Integer64 interface{ int64 | uint64 }
 type Num64 interface{ Integer64 | float64 }
@@ -191,9 +418,43 @@ type Num64 interface{ Integer64 | float64 }
 type F64Binary func(x, y float64) float64
 type I64Binary func(x, y int64) int64
 type U64Binary func(x, y uint64) uint64
+type BigBinary func(x, y *big.Int) *big.Int
+
+// maxUntypedBits limits the size of untyped integers.
+const maxUntypedBits = 1 << 16
+
+// errDivideByZero matches the error from dividing fixed width integers by
+// zero.
+var errDivideByZero = errors.New("runtime error: integer divide by zero")
+
+// untypedInts reports whether all of nums are untyped integers.
+func untypedInts(nums ...Num) bool {
+	for _, num := range nums {
+		if num.typed || !num.CanInt() && !num.CanUint() {
+			return false
+		}
+	}
+	return true
+}
+
+// untypedInt returns v as an untyped integer. Like Go's untyped constants
+// these are exact, but values which fit in 64 bits use the 64 bit types.
+func untypedInt(v *big.Int) Num {
+	switch {
+	case v.BitLen() > maxUntypedBits:
+		panic(errors.New("untyped integer too large"))
+	case v.IsUint64():
+		return Num{v.Uint64(), false}
+	case v.IsInt64():
+		return Num{v.Int64(), false}
+	default:
+		return Num{v, false}
+	}
+}
 
 func outBits(nums ...Num) (int, bool) {
 	maxTyped := 0
+	maxUntyped := 64
 	typed := false
 	for _, num := range nums {
 		bits := num.Bits()
@@ -202,18 +463,74 @@ func outBits(nums ...Num) (int, bool) {
 			if bits > maxTyped {
 				maxTyped = bits
 			}
+		} else if bits > maxUntyped {
+			maxUntyped = bits
 		}
 	}
 	if !typed {
-		return 64, false
+		return maxUntyped, false
 	}
 	return maxTyped, typed
 }
 
-func dispatchBinary(n, m Num, fnF64 F64Binary, fnI64 I64Binary, fnU64 U64Binary) Num {
+// intNum returns the low bits of v as an integer of the given width.
+func intNum(v *big.Int, bits int, signed, typed bool) Num {
+	u := Uint128FromBig(v)
+	if signed {
+		return Num{u.Int128(), typed}.WithBits(bits)
+	}
+	return Num{u, typed}.WithBits(bits)
+}
+
+// propagateNaN returns the result of an operation on nums, of which at least
+// one is a NaN. Like x86's SSE instructions, it is the first NaN operand made
+// quiet, converted to the format of the result.
+func propagateNaN(nums ...Num) Num {
+	f, typed := outFloat(nums...)
+	for _, num := range nums {
+		if num.IsNaN() {
+			return floatNum(f, f.NaNFrom(floatFormat(num), floatBits(num)), typed)
+		}
+	}
+	panic("no NaN operand")
+}
+
+func dispatchBinary(n, m Num, fnF64 F64Binary, fnI64 I64Binary, fnU64 U64Binary, fnBig BigBinary, fnFloat FloatBinary, fnRat RatBinary) Num {
+	n, m = ratOperand(n, m), ratOperand(m, n)
 	w, typed := outBits(n, m)
+	if fixedPoint(n, m) {
+		return fixedBinary(n, m, fnFloat)
+	}
+	if n.IsNaN() || m.IsNaN() {
+		return propagateNaN(n, m)
+	}
+	if customFloat(n, m) {
+		return floatBinary(n, m, fnFloat)
+	}
+	if untypedRats(n, m) {
+		if z := fnRat(new(big.Rat), n.AsRat(), m.AsRat()); z != nil {
+			return ratNum(z)
+		}
+	}
 	if n.CanFloat() || m.CanFloat() {
-		return Num{fnF64(n.AsFloat(), m.AsFloat()), typed}.WithBits(w)
+		if w == 32 {
+			// float64 is wide enough to round +, -, * and / correctly to
+			// float32, but not other operations.
+			return roundBinary(Binary32, typed, n, m, fnFloat)
+		}
+		r := fnF64(n.AsFloat(), m.AsFloat())
+		if math.IsNaN(r) {
+			// Invalid operations give the default NaN, which differs between
+			// architectures in hardware.
+			return floatNum(Binary64, Binary64.NaN(), typed)
+		}
+		return Num{r, typed}
+	}
+	if untypedInts(n, m) {
+		return untypedInt(fnBig(n.AsBig(), m.AsBig()))
+	}
+	if w > 64 {
+		return intNum(fnBig(n.AsBig(), m.AsBig()), w, n.CanInt() || m.CanInt(), typed)
 	}
 	if n.CanInt() || m.CanInt() {
 		return Num{fnI64(n.AsInt(), m.AsInt()), typed}.WithBits(w)
@@ -221,28 +538,49 @@ func dispatchBinary(n, m Num, fnF64 F64Binary, fnI64 I64Binary, fnU64 U64Binary)
 	return Num{fnU64(n.AsUint(), m.AsUint()), typed}.WithBits(w)
 }
 
-func add[N Num64](n, m N) N { return n + m }
+func add[N Num64](n, m N) N         { return n + m }
+func addBig(n, m *big.Int) *big.Int { return new(big.Int).Add(n, m) }
+
+func (n Num) OpAdd(m Num) Num { return n.add(m, plainMode()) }
 
-func (n Num) OpAdd(m Num) Num {
-	return dispatchBinary(n, m, add[float64], add[int64], add[uint64])
+func (n Num) add(m Num, mode overflowMode) Num {
+	r := dispatchBinary(n, m, add[float64], add[int64], add[uint64], addBig, (*big.Float).Add, (*big.Rat).Add)
+	return overflow(mode, n, "+", m, r, addBig)
 }
 
-func sub[N Num64](n, m N) N { return n - m }
+func sub[N Num64](n, m N) N         { return n - m }
+func subBig(n, m *big.Int) *big.Int { return new(big.Int).Sub(n, m) }
 
-func (n Num) OpSub(m Num) Num {
-	return dispatchBinary(n, m, sub[float64], sub[int64], sub[uint64])
+func (n Num) OpSub(m Num) Num { return n.sub(m, plainMode()) }
+
+func (n Num) sub(m Num, mode overflowMode) Num {
+	r := dispatchBinary(n, m, sub[float64], sub[int64], sub[uint64], subBig, (*big.Float).Sub, (*big.Rat).Sub)
+	return overflow(mode, n, "-", m, r, subBig)
 }
 
-func mul[N Num64](n, m N) N { return n * m }
+func mul[N Num64](n, m N) N         { return n * m }
+func mulBig(n, m *big.Int) *big.Int { return new(big.Int).Mul(n, m) }
+
+func (n Num) OpMul(m Num) Num { return n.mul(m, plainMode()) }
 
-func (n Num) OpMul(m Num) Num {
-	return dispatchBinary(n, m, mul[float64], mul[int64], mul[uint64])
+func (n Num) mul(m Num, mode overflowMode) Num {
+	r := dispatchBinary(n, m, mul[float64], mul[int64], mul[uint64], mulBig, (*big.Float).Mul, (*big.Rat).Mul)
+	return overflow(mode, n, "*", m, r, mulBig)
 }
 
 func div[N Num64](n, m N) N { return n / m }
+func divBig(n, m *big.Int) *big.Int {
+	if m.Sign() == 0 {
+		panic(errDivideByZero)
+	}
+	return new(big.Int).Quo(n, m)
+}
+
+func (n Num) OpDiv(m Num) Num { return n.div(m, plainMode()) }
 
-func (n Num) OpDiv(m Num) Num {
-	return dispatchBinary(n, m, div[float64], div[int64], div[uint64])
+func (n Num) div(m Num, mode overflowMode) Num {
+	r := dispatchBinary(n, m, div[float64], div[int64], div[uint64], divBig, (*big.Float).Quo, quoRat)
+	return overflow(mode, n, "/", m, r, divBig)
 }
 
 func expFloat(n, m float64) float64 { return math.Pow(n, m) }
@@ -254,21 +592,104 @@ func expInt[N Integer64](n, m N) N {
 		return 0
 	}
 	acc := N(1)
-	for ; m > 0; m-- {
-		acc *= n
+	for ; m > 0; m >>= 1 {
+		if m&1 == 1 {
+			acc *= n
+		}
+		n *= n
 	}
 	return acc
 }
 
-func (n Num) OpExp(m Num) Num {
-	return dispatchBinary(n, m, expFloat, expInt[int64], expInt[uint64])
+// expBig computes n**m modulo 2**128, which is enough for any fixed width
+// result.
+func expBig(n, m *big.Int) *big.Int {
+	if n.Cmp(big1) == 0 || m.Sign() == 0 {
+		return big.NewInt(1)
+	}
+	if m.Sign() < 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).Exp(n, m, big2to128)
+}
+
+// expUntyped computes n**m exactly, with the same conventions as expInt.
+func expUntyped(n, m *big.Int) *big.Int {
+	if n.Cmp(big1) == 0 || m.Sign() == 0 {
+		return big.NewInt(1)
+	}
+	if m.Sign() < 0 {
+		return new(big.Int)
+	}
+	// Check the size of the result before computing it.
+	if n.BitLen() > 1 && (!m.IsInt64() || m.Int64() > maxUntypedBits/int64(n.BitLen()-1)) {
+		panic(errors.New("untyped integer too large"))
+	}
+	return new(big.Int).Exp(n, m, nil)
+}
+
+func (n Num) OpExp(m Num) Num { return n.exp(m, plainMode()) }
+
+func (n Num) exp(m Num, mode overflowMode) Num {
+	if untypedInts(n, m) {
+		return untypedInt(expUntyped(n.AsBig(), m.AsBig()))
+	}
+	// As for math.Pow, x**0 and 1**y are 1 even if the other operand is a
+	// NaN.
+	if n.IsNaN() && !m.IsNaN() && m.AsFloat() == 0 {
+		f := floatFormat(n)
+		n = floatNum(f, f.FromNum(Num{uint64(1), false}), n.typed)
+	}
+	if m.IsNaN() && !n.IsNaN() && n.AsFloat() == 1 {
+		m = Num{uint64(0), false}
+	}
+	r := dispatchBinary(n, m, expFloat, expInt[int64], expInt[uint64], expBig, powFloat, expRat)
+	return overflow(mode, n, "**", m, r, expExact)
+}
+
+// shiftMasks holds the masks applied to the shift counts of typed integers,
+// by width, as set by the shiftmask command. Without a mask, negative counts
+// shift the other way and counts of the width or more shift out every bit.
+var shiftMasks = map[int]int64{}
+
+// shiftCount returns the shift count m for n, masked as configured for the
+// width of n.
+func shiftCount(n, m Num) int {
+	mask, ok := shiftMasks[n.Bits()]
+	if ok && n.typed && !n.CanFloat() && !fixedPoint(n) {
+		return int(m.AsInt() & mask)
+	}
+	return int(m.AsInt())
 }
 
 func (n Num) OpShl(m Num) Num {
-	shift := int(m.AsInt())
+	shift := shiftCount(n, m)
 	var val any
-	if n.CanFloat() {
+	if untypedInts(n) {
+		return untypedInt(shiftBig(n.AsBig(), shift))
+	} else if v, ok := n.val.(*big.Rat); ok {
+		return ratNum(ldexpRat(v, shift))
+	} else if v, ok := n.val.(Float); ok {
+		return Num{Float{v.F, v.F.Ldexp(v.Bits, shift)}, n.typed}
+	} else if _, ok := n.val.(float32); ok {
+		return floatNum(Binary32, Binary32.Ldexp(floatBits(n), shift), n.typed)
+	} else if v, ok := n.val.(Fixed); ok {
+		x := n.AsBigFloat()
+		return Num{v.Q.FromBigFloat(x.SetMantExp(x, shift)), n.typed}
+	} else if n.CanFloat() {
 		val = math.Ldexp(n.Float(), shift)
+	} else if v, ok := n.val.(Int128); ok {
+		if shift < 0 {
+			val = v.Shr(uint(-shift))
+		} else {
+			val = v.Shl(uint(shift))
+		}
+	} else if v, ok := n.val.(Uint128); ok {
+		if shift < 0 {
+			val = v.Shr(uint(-shift))
+		} else {
+			val = v.Shl(uint(shift))
+		}
 	} else if n.CanInt() {
 		if shift < 0 {
 			val = n.Int() >> -shift
@@ -286,10 +707,33 @@ func (n Num) OpShl(m Num) Num {
 }
 
 func (n Num) OpShr(m Num) Num {
-	shift := int(m.AsInt())
+	shift := shiftCount(n, m)
 	var val any
-	if n.CanFloat() {
+	if untypedInts(n) {
+		return untypedInt(shiftBig(n.AsBig(), -shift))
+	} else if v, ok := n.val.(*big.Rat); ok {
+		return ratNum(ldexpRat(v, -shift))
+	} else if v, ok := n.val.(Float); ok {
+		return Num{Float{v.F, v.F.Ldexp(v.Bits, -shift)}, n.typed}
+	} else if _, ok := n.val.(float32); ok {
+		return floatNum(Binary32, Binary32.Ldexp(floatBits(n), -shift), n.typed)
+	} else if v, ok := n.val.(Fixed); ok {
+		x := n.AsBigFloat()
+		return Num{v.Q.FromBigFloat(x.SetMantExp(x, -shift)), n.typed}
+	} else if n.CanFloat() {
 		val = math.Ldexp(n.Float(), -shift)
+	} else if v, ok := n.val.(Int128); ok {
+		if shift < 0 {
+			val = v.Shl(uint(-shift))
+		} else {
+			val = v.Shr(uint(shift))
+		}
+	} else if v, ok := n.val.(Uint128); ok {
+		if shift < 0 {
+			val = v.Shl(uint(-shift))
+		} else {
+			val = v.Shr(uint(shift))
+		}
 	} else if n.CanInt() {
 		if shift < 0 {
 			val = n.Int() << -shift
@@ -306,11 +750,94 @@ func (n Num) OpShr(m Num) Num {
 	return Num{val, n.typed}.WithBits(n.Bits())
 }
 
+// OpLshr shifts right by m bits within the width of n, filling with zeros
+// whatever the signedness of n.
+func (n Num) OpLshr(m Num) Num { return n.shiftRaw(shiftCount(n, m), false) }
+
+// OpAshr shifts right by m bits within the width of n, filling with copies of
+// the top bit whatever the signedness of n.
+func (n Num) OpAshr(m Num) Num { return n.shiftRaw(shiftCount(n, m), true) }
+
+// shiftRaw shifts the bits of n right, or left for negative shifts, keeping
+// the type of n.
+func (n Num) shiftRaw(shift int, arith bool) Num {
+	w := n.Bits()
+	x := n.rawBits()
+	if arith && x.Bit(w-1) == 1 {
+		x.Sub(x, new(big.Int).Lsh(big1, uint(w)))
+	}
+	shift = max(min(shift, w), -w)
+	if shift >= 0 {
+		x.Rsh(x, uint(shift))
+	} else {
+		x.Lsh(x, uint(-shift))
+	}
+	return n.fromRawBits(x.And(x, lowMask(w)))
+}
+
+// shiftBig shifts v left by shift bits, or right for negative shifts.
+func shiftBig(v *big.Int, shift int) *big.Int {
+	if shift < 0 {
+		return new(big.Int).Rsh(v, uint(-shift))
+	}
+	if shift > maxUntypedBits {
+		panic(errors.New("untyped integer too large"))
+	}
+	return new(big.Int).Lsh(v, uint(shift))
+}
+
+// OpNeg returns -n. Floats have their sign bit flipped, as IEEE 754's negate
+// does, so NaNs keep their payload and stay signaling.
 func (n Num) OpNeg() Num {
+	if encodedFloat(n) {
+		x := n.rawBits()
+		return n.fromRawBits(x.SetBit(x, n.Bits()-1, x.Bit(n.Bits()-1)^1))
+	}
 	return n.OpMul(Num{int64(-1), false})
 }
 
+// customFloat reports whether any of nums is a Float.
+func customFloat(nums ...Num) bool {
+	for _, num := range nums {
+		if _, ok := num.val.(Float); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// bitwiseBig applies op to each 64 bit limb of the two's complement
+// representations of x and y. Untyped integers which fit in 64 bits keep the
+// behavior of uint64 and int64 instead.
+func bitwiseBig(x, y *big.Int, op func(x, y uint64) uint64) *big.Int {
+	// Include a limb beyond the widest operand, holding only sign bits.
+	limbs := max(x.BitLen(), y.BitLen())/64 + 1
+	out := new(big.Int)
+	for i := limbs - 1; i >= 0; i-- {
+		xi := Uint128FromBig(new(big.Int).Rsh(x, uint(64*i))).Lo
+		yi := Uint128FromBig(new(big.Int).Rsh(y, uint(64*i))).Lo
+		out.Lsh(out, 64).Or(out, new(big.Int).SetUint64(op(xi, yi)))
+	}
+	if out.Bit(64*limbs-1) == 1 {
+		out.Sub(out, new(big.Int).Lsh(big1, uint(64*limbs)))
+	}
+	return out
+}
+
 func dispatchBitwiseBinary(n, m Num, op func(x, y uint64) uint64) Num {
+	if untypedInts(n, m) && max(n.Bits(), m.Bits()) > 64 {
+		return untypedInt(bitwiseBig(n.AsBig(), m.AsBig(), op))
+	}
+	if fixedPoint(n, m) {
+		return Num{outFixed(n, m).FromRaw(op(n.AsBits(), m.AsBits())), true}
+	}
+	if customFloat(n, m) {
+		f, typed := outFloat(n, m)
+		x := floatBits(n)
+		y := floatBits(m)
+		out := Uint128{op(x.Hi, y.Hi), op(x.Lo, y.Lo)}
+		return floatNum(f, out.Trunc(f.Bits()), typed)
+	}
 	if n.CanFloat() || m.CanFloat() {
 		x := n.AsBits()
 		y := m.AsBits()
@@ -322,6 +849,15 @@ func dispatchBitwiseBinary(n, m Num, op func(x, y uint64) uint64) Num {
 			return Num{math.Float32frombits(uint32(out)), typed}
 		}
 	}
+	if nbits, typed := outBits(n, m); nbits == 128 {
+		x := n.AsUint128()
+		y := m.AsUint128()
+		val := Uint128{op(x.Hi, y.Hi), op(x.Lo, y.Lo)}
+		if n.CanInt() || m.CanInt() {
+			return Num{val.Int128(), typed}
+		}
+		return Num{val, typed}
+	}
 	if n.CanInt() || m.CanInt() {
 		x := n.AsUint()
 		y := m.AsUint()
@@ -336,11 +872,31 @@ func dispatchBitwiseBinary(n, m Num, op func(x, y uint64) uint64) Num {
 }
 
 func dispatchBitwiseUnary(n Num, op func(x uint64) uint64) Num {
+	if untypedInts(n) && n.Bits() > 64 {
+		return untypedInt(bitwiseBig(n.AsBig(), new(big.Int), func(x, _ uint64) uint64 {
+			return op(x)
+		}))
+	}
+	if v, ok := n.val.(Fixed); ok {
+		return Num{v.Q.FromRaw(op(v.Raw)), n.typed}
+	}
+	if v, ok := n.val.(Float); ok {
+		out := Uint128{op(v.Bits.Hi), op(v.Bits.Lo)}
+		return Num{Float{v.F, out.Trunc(v.F.Bits())}, n.typed}
+	}
 	if n.CanFloat() {
 		x := math.Float64bits(n.Float())
 		val := math.Float64frombits(op(x))
 		return Num{val, n.typed}.WithBits(n.Bits())
 	}
+	if n.Bits() == 128 {
+		x := n.AsUint128()
+		val := Uint128{op(x.Hi), op(x.Lo)}
+		if n.CanInt() {
+			return Num{val.Int128(), n.typed}
+		}
+		return Num{val, n.typed}
+	}
 	if n.CanInt() {
 		x := n.AsUint()
 		val := Num{op(x), n.typed}.AsInt()
@@ -373,15 +929,597 @@ func (n Num) OpNot() Num {
 	})
 }
 
+// lowMask returns a mask of the low bits bits.
+func lowMask(bits int) *big.Int {
+	mask := new(big.Int).Lsh(big1, uint(bits))
+	return mask.Sub(mask, big1)
+}
+
+// fieldBits returns the bits of n for bit and field manipulation. Untyped
+// integers are in two's complement of unlimited width.
+func (n Num) fieldBits() *big.Int {
+	if untypedInts(n) {
+		return new(big.Int).Set(n.AsBig())
+	}
+	return n.rawBits()
+}
+
+// withFieldBits is the inverse of fieldBits, truncating x to the width of a
+// typed n.
+func (n Num) withFieldBits(x *big.Int) Num {
+	if untypedInts(n) {
+		return untypedInt(x)
+	}
+	return n.fromRawBits(x.And(x, lowMask(n.Bits())))
+}
+
+// bitRange checks that the size bits from bit lo are within the bits of n.
+func bitRange(n Num, lo, size int64) {
+	limit := int64(maxUntypedBits)
+	if !untypedInts(n) {
+		limit = int64(n.Bits())
+	}
+	if size < 0 || size > limit || lo < 0 || lo > limit-size {
+		if size == 1 {
+			panic(fmt.Errorf("bit %d out of range for %d bit value", lo, limit))
+		}
+		// The last bit may be beyond the range of int64.
+		hi := big.NewInt(lo)
+		hi.Add(hi, big.NewInt(size-1))
+		panic(fmt.Errorf("bits %d to %v out of range for %d bit value", lo, hi, limit))
+	}
+}
+
+// OpBset sets bit m of n.
+func (n Num) OpBset(m Num) Num {
+	bitRange(n, m.AsInt(), 1)
+	x := n.fieldBits()
+	return n.withFieldBits(x.SetBit(x, int(m.AsInt()), 1))
+}
+
+// OpBclr clears bit m of n.
+func (n Num) OpBclr(m Num) Num {
+	bitRange(n, m.AsInt(), 1)
+	x := n.fieldBits()
+	return n.withFieldBits(x.SetBit(x, int(m.AsInt()), 0))
+}
+
+// OpBtgl toggles bit m of n.
+func (n Num) OpBtgl(m Num) Num {
+	bitRange(n, m.AsInt(), 1)
+	x := n.fieldBits()
+	i := int(m.AsInt())
+	return n.withFieldBits(x.SetBit(x, i, x.Bit(i)^1))
+}
+
+// OpBtst returns bit m of n as an untyped integer.
+func (n Num) OpBtst(m Num) Num {
+	bitRange(n, m.AsInt(), 1)
+	return Num{uint64(n.fieldBits().Bit(int(m.AsInt()))), false}
+}
+
+// OpBextr returns the size bits of n from bit lo. The field has the type of n
+// if n is an integer and is an untyped integer otherwise.
+func (n Num) OpBextr(lo, size Num) Num {
+	bitRange(n, lo.AsInt(), size.AsInt())
+	x := n.fieldBits()
+	x.Rsh(x, uint(lo.AsInt())).And(x, lowMask(int(size.AsInt())))
+	if n.CanFloat() || fixedPoint(n) {
+		return untypedInt(x)
+	}
+	return n.withFieldBits(x)
+}
+
+// OpBinsert replaces the size bits of n from bit lo with field, which must fit
+// in size bits as either a signed or unsigned integer.
+func (n Num) OpBinsert(field, lo, size Num) Num {
+	bitRange(n, lo.AsInt(), size.AsInt())
+	f := field.AsBig()
+	bits := int(size.AsInt())
+	min := new(big.Int)
+	if bits > 0 {
+		min.Lsh(big1, uint(bits-1)).Neg(min)
+	}
+	if f.Cmp(min) < 0 || f.Cmp(lowMask(bits)) > 0 {
+		panic(fmt.Errorf("field %v does not fit in %d bits", f, bits))
+	}
+	mask := lowMask(bits)
+	x := n.fieldBits()
+	x.AndNot(x, new(big.Int).Lsh(mask, uint(lo.AsInt())))
+	f = new(big.Int).And(f, mask)
+	return n.withFieldBits(x.Or(x, f.Lsh(f, uint(lo.AsInt()))))
+}
+
+// OpSext sign extends n from bit m, copying it to all the bits above.
+func (n Num) OpSext(m Num) Num {
+	bitRange(n, m.AsInt(), 1)
+	i := int(m.AsInt())
+	x := n.fieldBits()
+	sign := x.Bit(i)
+	x.And(x, lowMask(i+1))
+	if sign == 1 {
+		x.Sub(x, new(big.Int).Lsh(big1, uint(i+1)))
+	}
+	return n.withFieldBits(x)
+}
+
+// OpZext zero extends n from bit m, clearing all the bits above.
+func (n Num) OpZext(m Num) Num {
+	bitRange(n, m.AsInt(), 1)
+	x := n.fieldBits()
+	return n.withFieldBits(x.And(x, lowMask(int(m.AsInt())+1)))
+}
+
+// requireInts panics unless nums are all integers.
+func requireInts(name string, nums ...Num) {
+	for _, num := range nums {
+		if num.CanFloat() || fixedPoint(num) {
+			panic(fmt.Errorf("%s needs integers, not %s", name, num.Type()))
+		}
+	}
+}
+
+// maskBits returns the width of masks of the type of n.
+func maskBits(n Num) int64 {
+	if untypedInts(n) {
+		return maxUntypedBits
+	}
+	return int64(n.Bits())
+}
+
+// OpGenmask returns a mask of bits hi down to lo inclusive, like Linux's
+// GENMASK, with the type of hi.
+func (hi Num) OpGenmask(lo Num) Num {
+	requireInts("genmask", hi, lo)
+	h, l := hi.AsInt(), lo.AsInt()
+	if l < 0 || l > h || h >= maskBits(hi) {
+		panic(fmt.Errorf("genmask needs 0 <= lo <= hi < %d", maskBits(hi)))
+	}
+	mask := lowMask(int(h + 1))
+	return hi.withFieldBits(mask.AndNot(mask, lowMask(int(l))))
+}
+
+// OpLomask returns a mask of the low n bits, with the type of n.
+func (n Num) OpLomask() Num {
+	requireInts("lomask", n)
+	k := n.AsInt()
+	if k < 0 || k > maskBits(n) {
+		panic(fmt.Errorf("lomask needs 0 <= n <= %d", maskBits(n)))
+	}
+	return n.withFieldBits(lowMask(int(k)))
+}
+
+// OpHimask returns a mask of the high n bits of the type of n.
+func (n Num) OpHimask() Num {
+	requireInts("himask", n)
+	k, w := n.AsInt(), n.Bits()
+	if k < 0 || k > int64(w) {
+		panic(fmt.Errorf("himask needs 0 <= n <= %d", w))
+	}
+	mask := lowMask(w)
+	return n.withFieldBits(mask.AndNot(mask, lowMask(w-int(k))))
+}
+
+// alignment returns m as an alignment for n.
+func alignment(name string, n, m Num) *big.Int {
+	requireInts(name, n, m)
+	a := m.AsBig()
+	if a.Sign() <= 0 {
+		panic(fmt.Errorf("%s needs a positive alignment", name))
+	}
+	return a
+}
+
+// OpAlignDown rounds n down to a multiple of m.
+func (n Num) OpAlignDown(m Num) Num {
+	a := alignment("aligndown", n, m)
+	x := n.AsBig()
+	return n.withFieldBits(new(big.Int).Sub(x, new(big.Int).Mod(x, a)))
+}
+
+// OpAlignUp rounds n up to a multiple of m. Results too large for the type of
+// n wrap around, as in C.
+func (n Num) OpAlignUp(m Num) Num {
+	a := alignment("alignup", n, m)
+	x := new(big.Int).Neg(n.AsBig())
+	x.Sub(x, new(big.Int).Mod(x, a))
+	return n.withFieldBits(x.Neg(x))
+}
+
+// OpIsAligned returns 1 if n is a multiple of m, otherwise 0.
+func (n Num) OpIsAligned(m Num) Num {
+	a := alignment("isaligned", n, m)
+	return boolNum(new(big.Int).Mod(n.AsBig(), a).Sign() == 0)
+}
+
+// boolNum returns 1 for true and 0 for false as an untyped integer.
+func boolNum(b bool) Num {
+	if b {
+		return Num{uint64(1), false}
+	}
+	return Num{uint64(0), false}
+}
+
+// isPow2 reports whether x is a power of 2.
+func isPow2(x *big.Int) bool {
+	return x.Sign() > 0 && x.TrailingZeroBits() == uint(x.BitLen()-1)
+}
+
+// OpIsPow2 returns 1 if n is a power of 2, otherwise 0.
+func (n Num) OpIsPow2() Num {
+	requireInts("ispow2", n)
+	return boolNum(isPow2(n.AsBig()))
+}
+
+// OpNextPow2 returns the smallest power of 2 no less than n.
+func (n Num) OpNextPow2() Num {
+	requireInts("nextpow2", n)
+	x := n.AsBig()
+	p := big.NewInt(1)
+	if x.Cmp(p) > 0 {
+		p.Lsh(p, uint(new(big.Int).Sub(x, big1).BitLen()))
+	}
+	r := n.withFieldBits(new(big.Int).Set(p))
+	if r.AsBig().Cmp(p) != 0 {
+		panic(fmt.Errorf("nextpow2 of %v overflows %s", x, n.Type()))
+	}
+	return r
+}
+
+// OpPrevPow2 returns the largest power of 2 no greater than n.
+func (n Num) OpPrevPow2() Num {
+	requireInts("prevpow2", n)
+	x := n.AsBig()
+	if x.Sign() <= 0 {
+		panic(errors.New("prevpow2 of non-positive value"))
+	}
+	return n.withFieldBits(new(big.Int).Lsh(big1, uint(x.BitLen()-1)))
+}
+
+// dispatchDeposit applies fn, with operands and result unsigned of the output
+// width, to the integers n and m.
+func dispatchDeposit(name string, n, m Num, fn func(x, mask *big.Int) *big.Int) Num {
+	requireInts(name, n, m)
+	w, typed := outBits(n, m)
+	x := new(big.Int).And(n.AsBig(), lowMask(w))
+	mask := new(big.Int).And(m.AsBig(), lowMask(w))
+	out := fn(x, mask)
+	if untypedInts(n, m) {
+		return untypedInt(out)
+	}
+	return intNum(out, w, n.CanInt() || m.CanInt(), typed)
+}
+
+// OpPdep deposits the low bits of n at the positions of the set bits of m,
+// like BMI2's PDEP.
+func (n Num) OpPdep(m Num) Num {
+	return dispatchDeposit("pdep", n, m, func(x, mask *big.Int) *big.Int {
+		out := new(big.Int)
+		k := 0
+		for i := 0; i < mask.BitLen(); i++ {
+			if mask.Bit(i) == 1 {
+				out.SetBit(out, i, x.Bit(k))
+				k++
+			}
+		}
+		return out
+	})
+}
+
+// OpPext gathers the bits of n at the positions of the set bits of m into the
+// low bits, like BMI2's PEXT.
+func (n Num) OpPext(m Num) Num {
+	return dispatchDeposit("pext", n, m, func(x, mask *big.Int) *big.Int {
+		out := new(big.Int)
+		k := 0
+		for i := 0; i < mask.BitLen(); i++ {
+			if mask.Bit(i) == 1 {
+				out.SetBit(out, k, x.Bit(i))
+				k++
+			}
+		}
+		return out
+	})
+}
+
+// halves returns half the width of n, which must be even.
+func halves(name string, n Num) int {
+	w := n.Bits()
+	if w%2 != 0 {
+		panic(fmt.Errorf("%s needs an even width, not %d", name, w))
+	}
+	return w / 2
+}
+
+// OpZip interleaves the bits of the low and high halves of n, with the low
+// half in the even bits, like RISC-V's zip. A value holding x in its low half
+// and y in its high half gives their Morton code.
+func (n Num) OpZip() Num {
+	h := halves("zip", n)
+	x := n.rawBits()
+	out := new(big.Int)
+	for i := 0; i < h; i++ {
+		out.SetBit(out, 2*i, x.Bit(i))
+		out.SetBit(out, 2*i+1, x.Bit(h+i))
+	}
+	return n.fromRawBits(out)
+}
+
+// OpUnzip is the inverse of OpZip, gathering the even bits of n into its low
+// half and the odd bits into its high half.
+func (n Num) OpUnzip() Num {
+	h := halves("unzip", n)
+	x := n.rawBits()
+	out := new(big.Int)
+	for i := 0; i < h; i++ {
+		out.SetBit(out, i, x.Bit(2*i))
+		out.SetBit(out, h+i, x.Bit(2*i+1))
+	}
+	return n.fromRawBits(out)
+}
+
+// OpBperm permutes the bits of n, setting bit i of the result to bit idx[i]
+// of n. Bits beyond the indexes given are cleared.
+func (n Num) OpBperm(idx []Num) Num {
+	w := n.Bits()
+	if len(idx) > w {
+		panic(fmt.Errorf("bperm given %d indexes for %d bit value", len(idx), w))
+	}
+	x := n.rawBits()
+	out := new(big.Int)
+	for i, j := range idx {
+		bitRange(n, j.AsInt(), 1)
+		out.SetBit(out, i, x.Bit(int(j.AsInt())))
+	}
+	return n.fromRawBits(out)
+}
+
+// rawBits returns the bits of n as an unsigned integer of n.Bits() bits.
+// Floats and fixed point values give their encoding.
+func (n Num) rawBits() *big.Int {
+	switch v := n.val.(type) {
+	case Float:
+		return v.Bits.Big()
+	case Fixed:
+		return new(big.Int).SetUint64(v.Raw)
+	}
+	if n.CanFloat() {
+		return new(big.Int).SetUint64(n.AsBits())
+	}
+	i := n.AsBig()
+	if i.Sign() < 0 {
+		i = new(big.Int).Add(i, new(big.Int).Lsh(big1, uint(n.Bits())))
+	}
+	return i
+}
+
+// fromRawBits is the inverse of rawBits, returning the value of n's type with
+// the bits x.
+func (n Num) fromRawBits(x *big.Int) Num {
+	switch v := n.val.(type) {
+	case Float:
+		return Num{Float{v.F, Uint128FromBig(x)}, n.typed}
+	case Fixed:
+		return Num{v.Q.FromRaw(x.Uint64()), n.typed}
+	case float32:
+		return Num{math.Float32frombits(uint32(x.Uint64())), n.typed}
+	}
+	if n.CanFloat() {
+		return Num{math.Float64frombits(x.Uint64()), n.typed}
+	}
+	w := n.Bits()
+	if !n.typed {
+		if n.CanInt() && x.Bit(w-1) == 1 {
+			x = new(big.Int).Sub(x, new(big.Int).Lsh(big1, uint(w)))
+		}
+		return untypedInt(x)
+	}
+	return intNum(x, w, n.CanInt(), n.typed)
+}
+
+// popCount returns the number of set bits in x, which must not be negative.
+func popCount(x *big.Int) int {
+	count := 0
+	for _, w := range x.Bits() {
+		count += bits.OnesCount(uint(w))
+	}
+	return count
+}
+
+// bitCount applies fn to the bits of n and its width, giving an untyped
+// integer.
+func bitCount(n Num, fn func(x *big.Int, width int) int) Num {
+	return untypedInt(big.NewInt(int64(fn(n.rawBits(), n.Bits()))))
+}
+
+// OpPopcnt counts the set bits.
+func (n Num) OpPopcnt() Num {
+	return bitCount(n, func(x *big.Int, _ int) int { return popCount(x) })
+}
+
+// OpClz counts the leading zero bits, giving the width for zero.
+func (n Num) OpClz() Num {
+	return bitCount(n, func(x *big.Int, width int) int { return width - x.BitLen() })
+}
+
+// OpCtz counts the trailing zero bits, giving the width for zero.
+func (n Num) OpCtz() Num {
+	return bitCount(n, func(x *big.Int, width int) int {
+		if x.Sign() == 0 {
+			return width
+		}
+		return int(x.TrailingZeroBits())
+	})
+}
+
+// OpClrsb counts the bits following the sign bit which are the same as it.
+func (n Num) OpClrsb() Num {
+	return bitCount(n, func(x *big.Int, width int) int {
+		if x.Bit(width-1) == 1 {
+			mask := new(big.Int).Lsh(big1, uint(width))
+			x = new(big.Int).Xor(x, mask.Sub(mask, big1))
+		}
+		return width - x.BitLen() - 1
+	})
+}
+
+// OpParity gives 1 if an odd number of bits are set and 0 otherwise.
+func (n Num) OpParity() Num {
+	return bitCount(n, func(x *big.Int, _ int) int { return popCount(x) % 2 })
+}
+
+// OpFfs gives the one based index of the least significant set bit, or 0 if
+// none are set.
+func (n Num) OpFfs() Num {
+	return bitCount(n, func(x *big.Int, _ int) int {
+		if x.Sign() == 0 {
+			return 0
+		}
+		return int(x.TrailingZeroBits()) + 1
+	})
+}
+
+// OpFls gives the one based index of the most significant set bit, or 0 if
+// none are set.
+func (n Num) OpFls() Num {
+	return bitCount(n, func(x *big.Int, _ int) int { return x.BitLen() })
+}
+
+// OpIlog2 gives the base 2 logarithm rounded down, which is the index of the
+// most significant set bit.
+func (n Num) OpIlog2() Num {
+	if n.CanInt() && n.AsBig().Sign() < 0 {
+		panic(errors.New("ilog2 of negative value"))
+	}
+	return bitCount(n, func(x *big.Int, _ int) int {
+		if x.Sign() == 0 {
+			panic(errors.New("ilog2 of zero"))
+		}
+		return x.BitLen() - 1
+	})
+}
+
+// OpRotl rotates left by m bits within the width of n. Negative counts
+// rotate right.
+func (n Num) OpRotl(m Num) Num {
+	w := n.Bits()
+	k := int(m.AsInt() % int64(w))
+	if k < 0 {
+		k += w
+	}
+	x := n.rawBits()
+	out := new(big.Int).Lsh(x, uint(k))
+	out.Or(out, new(big.Int).Rsh(x, uint(w-k)))
+	return n.fromRawBits(out.And(out, lowMask(w)))
+}
+
+// OpRotr rotates right by m bits within the width of n.
+func (n Num) OpRotr(m Num) Num {
+	return n.OpRotl(m.OpNeg())
+}
+
+// reverseChunks reverses the order of the chunk bit units within each group
+// of bits of n, or within all of n if group is zero. The width of n must be a
+// multiple of the group size.
+func (n Num) reverseChunks(name string, chunk, group int) Num {
+	w := n.Bits()
+	need := max(group, chunk)
+	if w%need != 0 {
+		panic(fmt.Errorf("%s needs a width which is a multiple of %d bits, not %d", name, need, w))
+	}
+	if group == 0 {
+		group = w
+	}
+	x := n.rawBits()
+	out := new(big.Int)
+	mask := big.NewInt(1<<chunk - 1)
+	for i := 0; i < w; i += chunk {
+		unit := new(big.Int).Rsh(x, uint(i))
+		unit.And(unit, mask)
+		// Mirror the unit's position within its group.
+		base := i / group * group
+		j := base + group - chunk - (i - base)
+		out.Or(out, unit.Lsh(unit, uint(j)))
+	}
+	return n.fromRawBits(out)
+}
+
+// OpBswap reverses the order of the bytes.
+func (n Num) OpBswap() Num { return n.reverseChunks("bswap", 8, 0) }
+
+// OpBswap16 reverses the order of the bytes in each 16 bit halfword.
+func (n Num) OpBswap16() Num { return n.reverseChunks("bswap16", 8, 16) }
+
+// OpBswap32 reverses the order of the bytes in each 32 bit word.
+func (n Num) OpBswap32() Num { return n.reverseChunks("bswap32", 8, 32) }
+
+// OpHswap reverses the order of the 16 bit halfwords.
+func (n Num) OpHswap() Num { return n.reverseChunks("hswap", 16, 0) }
+
+// OpNswap swaps the nibbles of each byte.
+func (n Num) OpNswap() Num { return n.reverseChunks("nswap", 4, 8) }
+
+// OpBrev reverses the order of the bits.
+func (n Num) OpBrev() Num { return n.reverseChunks("brev", 1, 0) }
+
+// OpBrev8 reverses the order of the bits in each byte.
+func (n Num) OpBrev8() Num { return n.reverseChunks("brev8", 1, 8) }
+
 func (n Num) OpBits() Num {
+	if v, ok := n.val.(Float); ok {
+		if v.F.Bits() > 64 {
+			return Num{v.Bits, n.typed}
+		}
+		return Num{v.Bits, n.typed}.WithBits(v.F.Bits())
+	}
+	if n.Bits() == 128 {
+		return Num{n.AsUint128(), n.typed}
+	}
 	return Num{n.AsBits(), n.typed}.WithBits(n.Bits())
 }
 
 func (n Num) OpFloatFromBits() Num {
 	switch n.Bits() {
+	case 8:
+		return n.OpE4M3FromBits()
+	case 16:
+		return n.OpF16FromBits()
 	case 64:
 		return Num{math.Float64frombits(n.AsBits()), n.typed}
+	case 80:
+		return n.OpF80FromBits()
+	case 128:
+		return n.OpF128FromBits()
 	default:
 		return Num{math.Float32frombits(uint32(n.AsBits())), n.typed}
 	}
 }
+
+func (n Num) OpF16FromBits() Num {
+	return Num{Float{Float16, Uint128{0, n.AsBits() & 0xffff}}, n.typed}
+}
+
+func (n Num) OpBF16FromBits() Num {
+	return Num{Float{BFloat16, Uint128{0, n.AsBits() & 0xffff}}, n.typed}
+}
+
+func (n Num) OpE4M3FromBits() Num {
+	return Num{Float{E4M3, Uint128{0, n.AsBits() & 0xff}}, n.typed}
+}
+
+func (n Num) OpE5M2FromBits() Num {
+	return Num{Float{E5M2, Uint128{0, n.AsBits() & 0xff}}, n.typed}
+}
+
+func (n Num) OpF80FromBits() Num {
+	return Num{Float{Float80, n.AsBits128().Trunc(80)}, n.typed}
+}
+
+func (n Num) OpF128FromBits() Num {
+	return Num{Float{Float128, n.AsBits128()}, n.typed}
+}
+
+// OpFloatBits converts the low bits of n to f.
+func (n Num) OpFloatBits(f *FloatFormat) Num {
+	return floatNum(f, n.AsBits128().Trunc(f.Bits()), n.typed)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// checkedMode makes the plain arithmetic operators report integer overflow
+// rather than wrapping around. It is set by the checked and wrapping commands.
+var checkedMode bool
+
+// overflowMode selects what happens when the result of integer arithmetic is
+// out of the range of its type.
+type overflowMode int
+
+const (
+	overflowWrap overflowMode = iota
+	overflowCheck
+	overflowSat
+)
+
+// plainMode returns the overflow mode of the plain arithmetic operators.
+func plainMode() overflowMode {
+	if checkedMode {
+		return overflowCheck
+	}
+	return overflowWrap
+}
+
+// fixedInt reports whether n is an integer of a fixed width type.
+func fixedInt(n Num) bool {
+	return n.typed && !n.CanFloat() && !fixedPoint(n)
+}
+
+// intRange returns the smallest and largest values of the integer type of n.
+func intRange(n Num) (*big.Int, *big.Int) {
+	w := n.Bits()
+	if n.CanInt() {
+		hi := lowMask(w - 1)
+		return new(big.Int).Not(hi), hi
+	}
+	return new(big.Int), lowMask(w)
+}
+
+// overflow handles the result r of the operation op on n and m, the exact
+// result of which fn computes, according to mode. Results which aren't
+// integers of a fixed width type can't overflow.
+func overflow(mode overflowMode, n Num, op string, m Num, r Num, fn BigBinary) Num {
+	if mode == overflowWrap || !fixedInt(r) {
+		return r
+	}
+	exact := fn(n.AsBig(), m.AsBig())
+	if r.AsBig().Cmp(exact) == 0 {
+		return r
+	}
+	if mode == overflowCheck {
+		panic(fmt.Errorf("%v %s %v overflows %s", n.concise(), op, m.concise(), r.Type()))
+	}
+	lo, hi := intRange(r)
+	if exact.Cmp(lo) < 0 {
+		exact = lo
+	} else {
+		exact = hi
+	}
+	return intNum(exact, r.Bits(), r.CanInt(), r.typed)
+}
+
+// expExact computes n**m with the conventions of expInt, but exactly for
+// results of up to 128 bits. Larger results are replaced by ±2**256, which is
+// out of the range of every fixed width type.
+func expExact(n, m *big.Int) *big.Int {
+	if n.CmpAbs(big1) <= 0 || m.Sign() <= 0 || m.IsInt64() && m.Int64() <= 129/int64(n.BitLen()-1) {
+		return expUntyped(n, m)
+	}
+	out := new(big.Int).Lsh(big1, 256)
+	if n.Sign() < 0 && m.Bit(0) == 1 {
+		out.Neg(out)
+	}
+	return out
+}
+
+// Checked operators report overflow and saturating operators clamp results to
+// the range of their type.
+
+func (n Num) OpAddChecked(m Num) Num { return n.add(m, overflowCheck) }
+func (n Num) OpSubChecked(m Num) Num { return n.sub(m, overflowCheck) }
+func (n Num) OpMulChecked(m Num) Num { return n.mul(m, overflowCheck) }
+func (n Num) OpDivChecked(m Num) Num { return n.div(m, overflowCheck) }
+func (n Num) OpExpChecked(m Num) Num { return n.exp(m, overflowCheck) }
+
+func (n Num) OpAddSat(m Num) Num { return n.add(m, overflowSat) }
+func (n Num) OpSubSat(m Num) Num { return n.sub(m, overflowSat) }
+func (n Num) OpMulSat(m Num) Num { return n.mul(m, overflowSat) }
+func (n Num) OpExpSat(m Num) Num { return n.exp(m, overflowSat) }
+
+// carryOperands returns the result r of op on n and m, wrapped around to its
+// type, and the bits of n and m at the width of r.
+func carryOperands(name string, n, m Num, op func(Num, Num) Num) (Num, *big.Int, *big.Int) {
+	r := op(n, m)
+	if !fixedInt(r) {
+		panic(fmt.Errorf("%s needs integers of a fixed width", name))
+	}
+	mask := lowMask(r.Bits())
+	return r, new(big.Int).And(n.AsBig(), mask), new(big.Int).And(m.AsBig(), mask)
+}
+
+// OpAddCarry returns n + m wrapped around to its type and the carry out of
+// the unsigned addition of their bits.
+func (n Num) OpAddCarry(m Num) (Num, Num) {
+	r, x, y := carryOperands("addc", n, m, func(n, m Num) Num { return n.add(m, overflowWrap) })
+	return r, boolNum(x.Add(x, y).BitLen() > r.Bits())
+}
+
+// OpSubBorrow returns n - m wrapped around to its type and the borrow out of
+// the unsigned subtraction of their bits.
+func (n Num) OpSubBorrow(m Num) (Num, Num) {
+	r, x, y := carryOperands("subb", n, m, func(n, m Num) Num { return n.sub(m, overflowWrap) })
+	return r, boolNum(x.Cmp(y) < 0)
+}
+
+// OpMulExtended returns the low and high halves of the double width product
+// of n and m, each of the type of the product. Both operands are taken at that
+// type, so the high half agrees with mulhu or mulhs.
+func (n Num) OpMulExtended(m Num) (Num, Num) {
+	t := fixedType("mulx", n, m)
+	w, signed := t.Bits(), t.CanInt()
+	p := new(big.Int).Mul(widthBits(n, w, signed), widthBits(m, w, signed))
+	lo := intNum(p, w, signed, t.typed)
+	return lo, intNum(p.Rsh(p, uint(w)), w, signed, t.typed)
+}
+
+// fixedType returns a value of the type of the result of arithmetic on nums,
+// which must be an integer type of a fixed width.
+func fixedType(name string, nums ...Num) Num {
+	t := nums[0]
+	for _, num := range nums[1:] {
+		t = t.add(num, overflowWrap)
+	}
+	if !fixedInt(t) {
+		panic(fmt.Errorf("%s needs integers of a fixed width", name))
+	}
+	return t
+}
+
+// widthBits returns the bits of n at width w, as a signed integer if signed.
+func widthBits(n Num, w int, signed bool) *big.Int {
+	x := new(big.Int).And(n.AsBig(), lowMask(w))
+	if signed && x.Bit(w-1) == 1 {
+		x.Sub(x, new(big.Int).Lsh(big1, uint(w)))
+	}
+	return x
+}
+
+// mulHigh returns the high half of the double width product of n and m, with
+// their bits taken as signed or unsigned.
+func mulHigh(name string, n, m Num, signed bool) Num {
+	t := fixedType(name, n, m)
+	w := t.Bits()
+	p := new(big.Int).Mul(widthBits(n, w, signed), widthBits(m, w, signed))
+	return intNum(p.Rsh(p, uint(w)), w, t.CanInt(), t.typed)
+}
+
+// OpMulHighUnsigned returns the high half of the unsigned double width
+// product of n and m, whatever their signedness.
+func (n Num) OpMulHighUnsigned(m Num) Num { return mulHigh("mulhu", n, m, false) }
+
+// OpMulHighSigned returns the high half of the signed double width product of
+// n and m, whatever their signedness.
+func (n Num) OpMulHighSigned(m Num) Num { return mulHigh("mulhs", n, m, true) }
+
+// OpDivWide divides the double width value with the high half hi and the low
+// half lo by d, like x86's DIV and IDIV, returning the quotient and the
+// remainder. The quotient must fit in the type of the operands.
+func (hi Num) OpDivWide(lo, d Num) (Num, Num) {
+	t := fixedType("divw", hi, lo, d)
+	w, signed := t.Bits(), t.CanInt()
+	x := widthBits(hi, w, signed)
+	x.Lsh(x, uint(w)).Or(x, widthBits(lo, w, false))
+	y := widthBits(d, w, signed)
+	if y.Sign() == 0 {
+		panic(errDivideByZero)
+	}
+	q, r := x.QuoRem(x, y, new(big.Int))
+	if min, max := intRange(t); q.Cmp(min) < 0 || q.Cmp(max) > 0 {
+		panic(fmt.Errorf("divw quotient overflows %s", t.Type()))
+	}
+	return intNum(q, w, signed, t.typed), intNum(r, w, signed, t.typed)
+}
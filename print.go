@@ -3,7 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"math"
+	"math/big"
 	"strings"
 )
 
@@ -20,6 +20,32 @@ func formatTable(kvs ...string) string {
 	return strings.Join(out, "\n")
 }
 
+// formatBig formats d like the "%#0*x" and "%#0*b" verbs format Go's integer
+// types, zero padding the digits of non-negative values to the given width.
+// Negative values are given as the digits of their magnitude alone, as the
+// width of the value's type says nothing about the width of its magnitude.
+func formatBig(d *big.Int, base int, width int) string {
+	prefix := map[int]string{2: "0b", 16: "0x"}[base]
+	sign := ""
+	if d.Sign() < 0 {
+		sign = "-"
+		width = 0
+	}
+	digits := new(big.Int).Abs(d).Text(base)
+	if len(digits) < width {
+		digits = strings.Repeat("0", width-len(digits)) + digits
+	}
+	return sign + prefix + digits
+}
+
+// concise returns the value shown by print and list.
+func (s Num) concise() any {
+	if r, ok := s.val.(*big.Rat); ok {
+		return exactDecimal(r)
+	}
+	return s.val
+}
+
 func (s Num) String() string {
 	jsonNumBytes, err := json.Marshal(s.val)
 	var jsonNum string
@@ -29,109 +55,42 @@ func (s Num) String() string {
 		jsonNum = string(jsonNumBytes)
 	}
 
-	if f, ok := s.val.(float64); ok {
-		bits := math.Float64bits(f)
-		signBit := (bits >> 63) & 1
-		expBits := int32((bits >> 52) & ((1 << 11) - 1))
-		manBits := bits & ((1 << 52) - 1)
-
-		sign := "+"
-		if signBit == 1 {
-			sign = "-"
-		}
-		var man string
-		switch expBits {
-		case 0:
-			// Zero or subnormal
-			if manBits == 0 {
-				man = "0"
-			} else {
-				man = fmt.Sprintf("0b0.%052b", manBits)
-			}
-		case (1 << 11) - 1:
-			// Inf or NaN
-			if manBits == 0 {
-				man = "Inf"
-			} else {
-				man = "NaN"
-			}
-		default:
-			// Normal
-			man = fmt.Sprintf("0b1.%052b", manBits)
-		}
-		man = strings.TrimRight(strings.TrimRight(man, "0"), ".")
-		man = fmt.Sprintf("%s (%#013x)", man, manBits)
-		return formatTable(
-			"type", fmt.Sprintf("%T", s.val),
-			"dec", fmt.Sprintf("%g", f),
-			"hex", fmt.Sprintf("%x", f),
-			"fixed", fmt.Sprintf("%.17e", f),
-			"json", jsonNum,
-			"bits", fmt.Sprintf("%#016x", bits),
-			"", fmt.Sprintf("0b%01b %011b %052b", signBit, expBits, manBits),
-			"", fmt.Sprintf("  %s %11d %52s", sign, expBits-1023, man),
-		)
+	switch v := s.val.(type) {
+	case Fixed:
+		return formatFixed(v, s.Type())
+	case Float:
+		return formatFloat(floatFormat(s), floatBits(s), s.Type(), exactRows(s)...)
+	case float32, float64:
+		return formatFloat(floatFormat(s), floatBits(s), s.Type(), append(exactRows(s), "json", jsonNum)...)
+	case *big.Rat:
+		return formatRat(v)
 	}
 
-	if f, ok := s.val.(float32); ok {
-		bits := math.Float32bits(f)
-		signBit := (bits >> 31) & 1
-		expBits := int32((bits >> 23) & ((1 << 8) - 1))
-		manBits := bits & ((1 << 23) - 1)
-
-		sign := "+"
-		if signBit == 1 {
-			sign = "-"
-		}
-		var man string
-		switch expBits {
-		case 0:
-			// Zero or subnormal
-			if manBits == 0 {
-				man = "0"
-			} else {
-				man = fmt.Sprintf("0b0.%023b", manBits)
-			}
-		case (1 << 8) - 1:
-			// Inf or NaN
-			if manBits == 0 {
-				man = "Inf"
-			} else {
-				man = "NaN"
-			}
-		default:
-			// Normal
-			man = fmt.Sprintf("0b1.%023b", manBits)
-		}
-		man = strings.TrimRight(strings.TrimRight(man, "0"), ".")
-		man = fmt.Sprintf("%s (%#06x)", man, manBits)
+	if s.Bits() > 64 {
+		d := s.AsBig()
 		return formatTable(
-			"type", fmt.Sprintf("%T", s.val),
-			"dec", fmt.Sprintf("%g", f),
-			"hex", fmt.Sprintf("%x", f),
-			"fixed", fmt.Sprintf("%.9e", f),
-			"json", jsonNum,
-			"bits", fmt.Sprintf("%#08x", bits),
-			"", fmt.Sprintf("0b%01b %08b %023b", signBit, expBits, manBits),
-			"", fmt.Sprintf("  %s %8d %23s", sign, expBits-127, man),
+			"type", s.Type(),
+			"dec", d.String(),
+			"hex", formatBig(d, 16, s.Bits()/4),
+			"bin", formatBig(d, 2, s.Bits()),
 		)
 	}
 
 	if s.CanInt() {
 		d := s.Int()
 		return formatTable(
-			"type", fmt.Sprintf("%T", s.val),
+			"type", s.Type(),
 			"dec", fmt.Sprintf("%d", d),
-			"hex", fmt.Sprintf("%#0*x", s.Bits()/4, d),
+			"hex", fmt.Sprintf("%#0*x", (s.Bits()+3)/4, d),
 			"bin", fmt.Sprintf("%#0*b", s.Bits(), d),
 		)
 	}
 
 	d := s.Uint()
 	return formatTable(
-		"type", fmt.Sprintf("%T", s.val),
+		"type", s.Type(),
 		"dec", fmt.Sprintf("%d", d),
-		"hex", fmt.Sprintf("%#0*x", s.Bits()/4, d),
+		"hex", fmt.Sprintf("%#0*x", (s.Bits()+3)/4, d),
 		"bin", fmt.Sprintf("%#0*b", s.Bits(), d),
 	)
 }
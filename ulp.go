@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Adjacent floats and the spacing between them. Encodings are ordered by
+// their magnitude, the encoding without the sign bit and with an implicit
+// leading bit, so adjacent values have adjacent magnitudes.
+
+// split returns the sign and magnitude of b, the inverse of join. X87
+// pseudo-denormals get the magnitude of the normal with the same value.
+func (f *FloatFormat) split(b Uint128) (sign uint, mag *big.Int) {
+	sign, exp, man := f.Fields(b)
+	if exp == 0 && f.Lead(b) == 1 {
+		exp = 1
+	}
+	return sign, man.Or(man, new(big.Int).Lsh(new(big.Int).SetUint64(exp), uint(f.Man)))
+}
+
+// magValue returns the value of the positive finite encoding with magnitude
+// mag, continuing the last binade past the largest finite value.
+func (f *FloatFormat) magValue(mag *big.Int) *big.Float {
+	exp := new(big.Int).Rsh(mag, uint(f.Man)).Int64()
+	man := new(big.Int).And(mag, f.manMask())
+	if exp > 0 {
+		man.SetBit(man, f.Man, 1)
+	}
+	x := new(big.Float).SetPrec(uint(f.Precision())).SetInt(man)
+	return x.SetMantExp(x, int(max(exp, 1))-f.Bias-f.Man)
+}
+
+// Next returns the encoding adjacent to b, the next larger one or if down the
+// next smaller one. Stepping past the largest finite value gives infinity, or
+// b itself in formats without infinities, and NaNs are returned unchanged.
+func (f *FloatFormat) Next(b Uint128, down bool) Uint128 {
+	if f.IsNaN(b) {
+		return b
+	}
+	sign, mag := f.split(b)
+	if mag.Sign() == 0 {
+		// Both zeros step to the smallest subnormal of the same direction.
+		sign = 0
+		if down {
+			sign = 1
+		}
+	}
+	away := mag.Sign() == 0 || (sign == 1) == down
+	switch {
+	case away && f.IsInf(b):
+		return b
+	case away && mag.Cmp(f.MaxFinite()) == 0:
+		if f.Specials == FN || f.Specials == Finite {
+			// Nothing lies beyond the largest value.
+			return b
+		}
+		return f.Inf(sign)
+	case away:
+		mag.Add(mag, big1)
+	case f.IsInf(b):
+		mag = f.MaxFinite()
+	default:
+		mag.Sub(mag, big1)
+	}
+	return f.join(sign, mag)
+}
+
+// Ulp returns the spacing of the encodings of the binade of b, or of the
+// subnormals for zero. Infinities give +Inf and NaNs are returned unchanged.
+func (f *FloatFormat) Ulp(b Uint128) Uint128 {
+	switch {
+	case f.IsNaN(b):
+		return b
+	case f.IsInf(b):
+		return f.Inf(0)
+	}
+	_, mag := f.split(b)
+	exp := max(mag.Rsh(mag, uint(f.Man)).Int64(), 1)
+	x := new(big.Float).SetInt64(1)
+	return f.Round(x.SetMantExp(x, int(exp)-f.Bias-f.Man))
+}
+
+// Interval returns the bounds of the values which round to b, which must not
+// be a NaN, and whether each bound itself rounds to b. Bounds are infinite
+// where every value beyond the other bound rounds to b.
+func (f *FloatFormat) Interval(b Uint128) (lo, hi *big.Float, loIn, hiIn bool) {
+	sign, mag := f.split(b)
+	mid := func(other *big.Int) (*big.Float, bool) {
+		x := new(big.Float).SetPrec(uint(f.Precision()+1)).Add(f.magValue(mag), f.magValue(other))
+		x.SetMantExp(x, -1)
+		_, rounded := f.split(f.Round(x))
+		return x, rounded.Cmp(mag) == 0
+	}
+	switch {
+	case f.IsInf(b):
+		hi, hiIn = new(big.Float).SetInf(false), true
+	case f.Specials == Finite && mag.Cmp(f.MaxFinite()) == 0:
+		// Values out of range saturate.
+		hi = new(big.Float).SetInf(false)
+	default:
+		hi, hiIn = mid(new(big.Int).Add(mag, big1))
+	}
+	if mag.Sign() == 0 {
+		lo, loIn = new(big.Float).Neg(hi), hiIn
+	} else {
+		lo, loIn = mid(new(big.Int).Sub(mag, big1))
+	}
+	if sign == 1 {
+		lo, hi = hi.Neg(hi), lo.Neg(lo)
+		loIn, hiIn = hiIn, loIn
+	}
+	return lo, hi, loIn, hiIn
+}
+
+// OpNextUp returns the smallest value of the format of n greater than n.
+func (n Num) OpNextUp() Num {
+	n = floatOperand("nextup", n)
+	f := floatFormat(n)
+	return floatNum(f, f.Next(floatBits(n), false), n.typed)
+}
+
+// OpNextDown returns the largest value of the format of n less than n.
+func (n Num) OpNextDown() Num {
+	n = floatOperand("nextdown", n)
+	f := floatFormat(n)
+	return floatNum(f, f.Next(floatBits(n), true), n.typed)
+}
+
+// OpUlp returns the spacing of the values of the format of n around n.
+func (n Num) OpUlp() Num {
+	n = floatOperand("ulp", n)
+	f := floatFormat(n)
+	return floatNum(f, f.Ulp(floatBits(n)), n.typed)
+}
+
+// ulpIndex returns the position of the float b in the order of the values of
+// its format, counting from zero.
+func ulpIndex(f *FloatFormat, b Uint128) *big.Int {
+	sign, mag := f.split(b)
+	if sign == 1 {
+		mag.Neg(mag)
+	}
+	return mag
+}
+
+// OpUlpDiff returns the number of values of the format of n and m from m to
+// n, which is negative if n is less than m. An untyped operand is first
+// rounded to the format of a typed one.
+func (n Num) OpUlpDiff(m Num) Num {
+	n, m = floatOperand("ulpdiff", n), floatOperand("ulpdiff", m)
+	f, g := floatFormat(n), floatFormat(m)
+	switch {
+	case n.typed && !m.typed:
+		m = floatNum(f, f.FromNum(m), false)
+	case m.typed && !n.typed:
+		n = floatNum(g, g.FromNum(n), false)
+	case f != g:
+		panic(fmt.Errorf("ulpdiff needs floats of the same format, not %s and %s", n.Type(), m.Type()))
+	}
+	if n.IsNaN() || m.IsNaN() {
+		panic(errors.New("ulpdiff of NaN"))
+	}
+	f = floatFormat(n)
+	d := ulpIndex(f, floatBits(n))
+	return untypedInt(d.Sub(d, ulpIndex(f, floatBits(m))))
+}
+
+// formatBound returns the text of an interval bound, exactly in exact mode.
+func formatBound(f *FloatFormat, x *big.Float) string {
+	if !exactMode || x.IsInf() {
+		return x.Text('e', f.Digits())
+	}
+	r, _ := x.Rat(nil)
+	return exactDecimal(r)
+}
+
+// formatNeighbors returns the description of the float n and the values
+// either side of it, with the interval of values which round to each.
+func formatNeighbors(n Num) string {
+	n = floatOperand("neighbors", n)
+	f, b := floatFormat(n), floatBits(n)
+	if f.IsNaN(b) {
+		panic(errors.New("neighbors of NaN"))
+	}
+	var kvs []string
+	row := func(key string, c Uint128) {
+		if key != "value" && c == b {
+			kvs = append(kvs, key, "none")
+			return
+		}
+		kvs = append(kvs, key, fmt.Sprintf("%s (%s)", f.Format(c), formatBig(c.Big(), 16, (f.Bits()+3)/4)))
+		if f.IsNaN(c) {
+			return
+		}
+		lo, hi, loIn, hiIn := f.Interval(c)
+		lb, rb := "(", ")"
+		if loIn {
+			lb = "["
+		}
+		if hiIn {
+			rb = "]"
+		}
+		kvs = append(kvs, "", fmt.Sprintf("%s%s, %s%s", lb, formatBound(f, lo), formatBound(f, hi), rb))
+	}
+	kvs = append(kvs, "type", n.Type())
+	row("prev", f.Next(b, true))
+	row("value", b)
+	row("next", f.Next(b, false))
+	return formatTable(append(kvs, "ulp", f.Format(f.Ulp(b)))...)
+}